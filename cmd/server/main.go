@@ -1,27 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"pr_reviewer_service_go/internal/db"
-	"pr_reviewer_service_go/internal/models"
 	"pr_reviewer_service_go/internal/router"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
 	db.Connect()
 	// db.DB.Migrator().DropTable(&models.User{}, &models.Team{}, &models.PullRequest{})
-	if err := db.DB.AutoMigrate(&models.User{}, &models.Team{}, &models.PullRequest{}); err != nil {
+	if err := db.Migrate(); err != nil {
 		log.Fatal("migrate:", err)
 	}
 
-	r := router.New()
+	r, watchers := router.New()
 	serverURL := os.Getenv("SERVER_URL")
 	if serverURL == "" {
 		log.Fatal("SERVER_URL environment variable is required")
 	}
 
-	if err := r.Run(serverURL); err != nil {
-		log.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, watch := range watchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watch(ctx)
+		}()
+	}
+
+	srv := &http.Server{Addr: serverURL, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("shutdown:", err)
 	}
+	// let a watcher finish the transaction it is in
+	wg.Wait()
 }
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -38,6 +41,106 @@ func TestAPI(t *testing.T) {
 	t.Run("Error cases", func(t *testing.T) {
 		testErrorCases(t, timestamp)
 	})
+
+	t.Run("Least loaded strategy", func(t *testing.T) {
+		testLeastLoadedStrategy(t)
+	})
+
+	t.Run("Team deactivation", func(t *testing.T) {
+		testTeamDeactivation(t)
+	})
+
+	t.Run("Assignment stats", func(t *testing.T) {
+		testAssignmentStats(t)
+	})
+
+	t.Run("Team add upsert", func(t *testing.T) {
+		testTeamAddUpsert(t)
+	})
+
+	t.Run("Team membership", func(t *testing.T) {
+		testTeamMembership(t)
+	})
+
+	t.Run("Team reflects user state", func(t *testing.T) {
+		testTeamReflectsUserState(t)
+	})
+
+	t.Run("Reviews", func(t *testing.T) {
+		testReviews(t)
+	})
+
+	t.Run("Merge policy", func(t *testing.T) {
+		testMergePolicy(t)
+	})
+
+	t.Run("Need more reviewers", func(t *testing.T) {
+		testNeedMoreReviewers(t)
+	})
+
+	t.Run("Reviewers count", func(t *testing.T) {
+		testReviewersCount(t)
+	})
+
+	t.Run("Fallback teams", func(t *testing.T) {
+		testFallbackTeams(t)
+	})
+
+	t.Run("Ownership rules", func(t *testing.T) {
+		testOwnershipRules(t)
+	})
+
+	t.Run("Absence", func(t *testing.T) {
+		testAbsence(t)
+	})
+
+	t.Run("Capacity", func(t *testing.T) {
+		testCapacity(t)
+	})
+
+	t.Run("Review rules", func(t *testing.T) {
+		testReviewRules(t)
+	})
+
+	t.Run("Seeded assignment", func(t *testing.T) {
+		testSeededAssignment(t)
+	})
+
+	t.Run("Concurrent round robin", func(t *testing.T) {
+		testConcurrentRoundRobin(t)
+	})
+
+	t.Run("Simulation", func(t *testing.T) {
+		testSimulation(t)
+	})
+
+	t.Run("Close and reopen", func(t *testing.T) {
+		testCloseReopen(t)
+	})
+
+	t.Run("Draft PR", func(t *testing.T) {
+		testDraftPR(t)
+	})
+
+	t.Run("PR metadata", func(t *testing.T) {
+		testPRMetadata(t)
+	})
+
+	t.Run("Review SLA", func(t *testing.T) {
+		testReviewSLA(t)
+	})
+
+	t.Run("Assignment history", func(t *testing.T) {
+		testAssignmentHistory(t)
+	})
+
+	t.Run("Reassign to user", func(t *testing.T) {
+		testReassignToUser(t)
+	})
+
+	t.Run("Decline review", func(t *testing.T) {
+		testDeclineReview(t)
+	})
 }
 
 func testFullWorkflow(t *testing.T, teamName, user1, user2, user3, user4, prID string) {
@@ -800,6 +903,2286 @@ func testErrorCases(t *testing.T, timestamp int64) {
 	t.Log("All error cases tested successfully")
 }
 
+func testLeastLoadedStrategy(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("ll_team_%d", ts)
+	author := fmt.Sprintf("ll_author_%d", ts)
+	users := []string{
+		fmt.Sprintf("ll_user1_%d", ts),
+		fmt.Sprintf("ll_user2_%d", ts),
+		fmt.Sprintf("ll_user3_%d", ts),
+	}
+
+	teamData := map[string]interface{}{
+		"team_name":         teamName,
+		"reviewer_strategy": "least_loaded",
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": users[0], "username": "LL1", "is_active": true},
+			{"user_id": users[1], "username": "LL2", "is_active": true},
+			{"user_id": users[2], "username": "LL3", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add with least_loaded: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Первый PR занимает двух из трёх, второй обязан достаться свободному
+	firstReviewers := createPRAndGetReviewers(t, fmt.Sprintf("ll_pr1_%d", ts), author)
+	secondReviewers := createPRAndGetReviewers(t, fmt.Sprintf("ll_pr2_%d", ts), author)
+
+	var idle string
+	for _, u := range users {
+		busy := false
+		for _, r := range firstReviewers {
+			if r == u {
+				busy = true
+			}
+		}
+		if !busy {
+			idle = u
+		}
+	}
+
+	foundIdle := false
+	for _, r := range secondReviewers {
+		if r == idle {
+			foundIdle = true
+		}
+	}
+	if !foundIdle {
+		t.Errorf("Least loaded strategy should pick idle user %s, got %v", idle, secondReviewers)
+	}
+
+	// Неизвестная стратегия
+	badTeamData := map[string]interface{}{
+		"team_name":         teamName + "_bad",
+		"reviewer_strategy": "by_horoscope",
+		"members":           []map[string]interface{}{},
+	}
+	badTeamJSON, _ := json.Marshal(badTeamData)
+
+	resp = makeRequest(t, "POST", "/team/add", badTeamJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /team/add with unknown strategy: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testTeamDeactivation(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("deact_team_%d", ts)
+	author := fmt.Sprintf("deact_author_%d", ts)
+	users := []string{
+		fmt.Sprintf("deact_user1_%d", ts),
+		fmt.Sprintf("deact_user2_%d", ts),
+		fmt.Sprintf("deact_user3_%d", ts),
+	}
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": users[0], "username": "D1", "is_active": true},
+			{"user_id": users[1], "username": "D2", "is_active": true},
+			{"user_id": users[2], "username": "D3", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("deact_pr_%d", ts)
+	reviewers := createPRAndGetReviewers(t, prID, author)
+	if len(reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %d", len(reviewers))
+	}
+
+	// Деактивируем одного ревьювера - его должен заменить оставшийся свободный участник
+	deactivateData := map[string]interface{}{
+		"team_name": teamName,
+		"user_ids":  []string{reviewers[0]},
+	}
+	deactivateJSON, _ := json.Marshal(deactivateData)
+
+	resp = makeRequest(t, "POST", "/team/deactivateUsers", deactivateJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/deactivateUsers: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var report map[string]interface{}
+	parseAndCheckResponse(t, resp, &report)
+	closeBody(t, resp)
+
+	prReports, ok := report["pull_requests"].([]interface{})
+	if !ok || len(prReports) != 1 {
+		t.Fatalf("Expected report for 1 PR, got %v", report["pull_requests"])
+	}
+	prReport := prReports[0].(map[string]interface{})
+	if prReport["pull_request_id"] != prID {
+		t.Errorf("Expected pull_request_id %s, got %s", prID, prReport["pull_request_id"])
+	}
+	replaced := prReport["replaced"].(map[string]interface{})
+	newReviewer, ok := replaced[reviewers[0]].(string)
+	if !ok || newReviewer == reviewers[1] || newReviewer == author || newReviewer == reviewers[0] {
+		t.Errorf("Unexpected replacement for %s: %v", reviewers[0], replaced)
+	}
+
+	// Пользователь не из команды - NOT_FOUND
+	unknownData := map[string]interface{}{
+		"team_name": teamName,
+		"user_ids":  []string{"nonexistent_user_123"},
+	}
+	unknownJSON, _ := json.Marshal(unknownData)
+
+	resp = makeRequest(t, "POST", "/team/deactivateUsers", unknownJSON)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST /team/deactivateUsers with unknown user: Expected 404, got %d", resp.StatusCode)
+	} else {
+		var errorResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &errorResponse)
+		checkErrorCode(t, errorResponse, "NOT_FOUND")
+		closeBody(t, resp)
+	}
+}
+
+func testAssignmentStats(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("stats_team_%d", ts)
+	author := fmt.Sprintf("stats_author_%d", ts)
+	reviewer1 := fmt.Sprintf("stats_user1_%d", ts)
+	reviewer2 := fmt.Sprintf("stats_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": reviewer1, "username": "S1", "is_active": true},
+			{"user_id": reviewer2, "username": "S2", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("stats_pr_%d", ts)
+	createPRAndGetReviewers(t, prID, author)
+
+	resp = makeRequest(t, "GET", "/stats/assignments?team_name="+teamName, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stats/assignments: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var stats map[string]interface{}
+	parseAndCheckResponse(t, resp, &stats)
+	closeBody(t, resp)
+
+	users := stats["users"].([]interface{})
+	if len(users) != 2 {
+		t.Fatalf("Expected stats for 2 reviewers, got %d", len(users))
+	}
+	for _, u := range users {
+		userStats := u.(map[string]interface{})
+		if userStats["total"] != float64(1) || userStats["open"] != float64(1) || userStats["merged"] != float64(0) {
+			t.Errorf("Unexpected stats for %s: %v", userStats["user_id"], userStats)
+		}
+	}
+
+	prs := stats["pull_requests"].([]interface{})
+	if len(prs) != 1 || prs[0].(map[string]interface{})["reviewers_count"] != float64(2) {
+		t.Errorf("Expected 1 PR with 2 reviewers, got %v", prs)
+	}
+
+	resp = makeRequest(t, "GET", "/stats/assignments?from=yesterday", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /stats/assignments with bad from: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testTeamAddUpsert(t *testing.T) {
+	ts := time.Now().UnixNano()
+	oldTeam := fmt.Sprintf("upsert_old_%d", ts)
+	newTeam := fmt.Sprintf("upsert_new_%d", ts)
+	movedUser := fmt.Sprintf("upsert_user1_%d", ts)
+	newUser := fmt.Sprintf("upsert_user2_%d", ts)
+
+	oldTeamData := map[string]interface{}{
+		"team_name": oldTeam,
+		"members": []map[string]interface{}{
+			{"user_id": movedUser, "username": "Before", "is_active": true},
+		},
+	}
+	oldTeamJSON, _ := json.Marshal(oldTeamData)
+
+	resp := makeRequest(t, "POST", "/team/add", oldTeamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Существующий пользователь переезжает в новую команду
+	newTeamData := map[string]interface{}{
+		"team_name": newTeam,
+		"members": []map[string]interface{}{
+			{"user_id": movedUser, "username": "After", "is_active": false},
+			{"user_id": newUser, "username": "Fresh", "is_active": true},
+		},
+	}
+	newTeamJSON, _ := json.Marshal(newTeamData)
+
+	resp = makeRequest(t, "POST", "/team/add", newTeamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add with existing user: Expected 201, got %d", resp.StatusCode)
+	}
+
+	var addResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &addResponse)
+	closeBody(t, resp)
+
+	created := addResponse["created_users"].([]interface{})
+	updated := addResponse["updated_users"].([]interface{})
+	if len(created) != 1 || created[0] != newUser {
+		t.Errorf("Expected created_users [%s], got %v", newUser, created)
+	}
+	if len(updated) != 1 || updated[0] != movedUser {
+		t.Errorf("Expected updated_users [%s], got %v", movedUser, updated)
+	}
+
+	// Пользователь больше не числится в старой команде
+	resp = makeRequest(t, "GET", "/team/get?team_name="+oldTeam, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /team/get: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var oldTeamResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &oldTeamResponse)
+	closeBody(t, resp)
+
+	if members := oldTeamResponse["members"].([]interface{}); len(members) != 0 {
+		t.Errorf("Expected old team to have no members, got %v", members)
+	}
+}
+
+func testTeamMembership(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("member_team_%d", ts)
+	renamed := fmt.Sprintf("member_team_renamed_%d", ts)
+	author := fmt.Sprintf("member_author_%d", ts)
+	reviewer := fmt.Sprintf("member_user1_%d", ts)
+	newcomer := fmt.Sprintf("member_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": reviewer, "username": "M1", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("member_pr_%d", ts)
+	if reviewers := createPRAndGetReviewers(t, prID, author); len(reviewers) != 1 || reviewers[0] != reviewer {
+		t.Fatalf("Expected reviewer %s, got %v", reviewer, reviewers)
+	}
+
+	// Добавляем участника
+	addData := map[string]interface{}{
+		"team_name": teamName,
+		"user_id":   newcomer,
+		"username":  "Newcomer",
+		"is_active": true,
+	}
+	addJSON, _ := json.Marshal(addData)
+
+	resp = makeRequest(t, "POST", "/team/addMember", addJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/addMember: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Исключаем ревьювера - PR переходит к новичку
+	removeData := map[string]string{"team_name": teamName, "user_id": reviewer}
+	removeJSON, _ := json.Marshal(removeData)
+
+	resp = makeRequest(t, "POST", "/team/removeMember", removeJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/removeMember: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var removeResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &removeResponse)
+	closeBody(t, resp)
+
+	prReports := removeResponse["pull_requests"].([]interface{})
+	if len(prReports) != 1 {
+		t.Fatalf("Expected 1 reassigned PR, got %v", prReports)
+	}
+	replaced := prReports[0].(map[string]interface{})["replaced"].(map[string]interface{})
+	if replaced[reviewer] != newcomer {
+		t.Errorf("Expected %s to be replaced by %s, got %v", reviewer, newcomer, replaced)
+	}
+
+	members := removeResponse["team"].(map[string]interface{})["members"].([]interface{})
+	if len(members) != 2 {
+		t.Errorf("Expected 2 members after removal, got %d", len(members))
+	}
+
+	// Переименовываем команду
+	renameData := map[string]string{"team_name": teamName, "new_team_name": renamed}
+	renameJSON, _ := json.Marshal(renameData)
+
+	resp = makeRequest(t, "POST", "/team/rename", renameJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/rename: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = makeRequest(t, "GET", "/team/get?team_name="+teamName, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /team/get with old name: Expected 404, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Автор по-прежнему получает ревьюверов из переименованной команды
+	if reviewers := createPRAndGetReviewers(t, prID+"_2", author); len(reviewers) != 1 || reviewers[0] != newcomer {
+		t.Errorf("Expected reviewer %s after rename, got %v", newcomer, reviewers)
+	}
+
+	// Исключённый участник остался без команды - PR создаётся без ревьюверов
+	teamlessData := map[string]string{
+		"pull_request_id":   prID + "_teamless",
+		"pull_request_name": "Teamless",
+		"author_id":         reviewer,
+	}
+	teamlessJSON, _ := json.Marshal(teamlessData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", teamlessJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create by teamless author: Expected 201, got %d", resp.StatusCode)
+	}
+
+	var teamlessResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &teamlessResponse)
+	closeBody(t, resp)
+
+	teamlessPR := teamlessResponse["pr"].(map[string]interface{})
+	if reviewers := teamlessPR["assigned_reviewers"].([]interface{}); len(reviewers) != 0 {
+		t.Errorf("Expected no reviewers for teamless author, got %v", reviewers)
+	}
+	if teamlessPR["need_more_reviewers"] != true {
+		t.Errorf("Expected need_more_reviewers for teamless author, got %v", teamlessPR["need_more_reviewers"])
+	}
+
+	// Возвращаем его и переводим новичка в другую команду - ревью новичка
+	// передаётся оставшимся в прежней команде
+	backData := map[string]interface{}{
+		"team_name": renamed,
+		"user_id":   reviewer,
+		"username":  "M1",
+		"is_active": true,
+	}
+	backJSON, _ := json.Marshal(backData)
+
+	resp = makeRequest(t, "POST", "/team/addMember", backJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/addMember: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	otherTeam := fmt.Sprintf("member_team_other_%d", ts)
+	otherData := map[string]interface{}{
+		"team_name": otherTeam,
+		"members": []map[string]interface{}{
+			{"user_id": fmt.Sprintf("member_user3_%d", ts), "username": "M3", "is_active": true},
+		},
+	}
+	otherJSON, _ := json.Marshal(otherData)
+
+	resp = makeRequest(t, "POST", "/team/add", otherJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	moveData := map[string]interface{}{
+		"team_name": otherTeam,
+		"user_id":   newcomer,
+		"username":  "Newcomer",
+		"is_active": true,
+	}
+	moveJSON, _ := json.Marshal(moveData)
+
+	resp = makeRequest(t, "POST", "/team/addMember", moveJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/addMember: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var moveResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &moveResponse)
+	closeBody(t, resp)
+
+	moved := moveResponse["pull_requests"].([]interface{})
+	if len(moved) != 2 {
+		t.Fatalf("Expected 2 handed over PRs, got %v", moved)
+	}
+	for _, report := range moved {
+		replaced := report.(map[string]interface{})["replaced"].(map[string]interface{})
+		if replaced[newcomer] != reviewer {
+			t.Errorf("Expected %s to be replaced by %s, got %v", newcomer, reviewer, replaced)
+		}
+	}
+}
+
+func testTeamReflectsUserState(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("state_team_%d", ts)
+	user := fmt.Sprintf("state_user_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": user, "username": "State", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	userData := map[string]interface{}{"user_id": user, "is_active": false}
+	userJSON, _ := json.Marshal(userData)
+
+	resp = makeRequest(t, "POST", "/users/setIsActive", userJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /users/setIsActive: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = makeRequest(t, "GET", "/team/get?team_name="+teamName, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /team/get: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var teamResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &teamResponse)
+	closeBody(t, resp)
+
+	members := teamResponse["members"].([]interface{})
+	if len(members) != 1 || members[0].(map[string]interface{})["is_active"] != false {
+		t.Errorf("GET /team/get should reflect is_active=false, got %v", members)
+	}
+}
+
+func testReviews(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("review_team_%d", ts)
+	author := fmt.Sprintf("review_author_%d", ts)
+	reviewer := fmt.Sprintf("review_user_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": reviewer, "username": "Reviewer", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("review_pr_%d", ts)
+	createPRAndGetReviewers(t, prID, author)
+
+	// Комментарий не снимает PR из очереди ревьювера
+	submitReview(t, prID, reviewer, "COMMENTED", http.StatusOK)
+	if !reviewQueueContains(t, reviewer, prID) {
+		t.Error("PR should stay in review list after COMMENTED")
+	}
+
+	// Одобрение снимает PR из очереди
+	submitReview(t, prID, reviewer, "APPROVED", http.StatusOK)
+	if reviewQueueContains(t, reviewer, prID) {
+		t.Error("PR should leave review list after APPROVED")
+	}
+
+	// Автор не назначен ревьювером - NOT_ASSIGNED
+	submitReview(t, prID, author, "APPROVED", http.StatusConflict)
+	// Неизвестное состояние
+	submitReview(t, prID, reviewer, "LGTM", http.StatusBadRequest)
+}
+
+func testMergePolicy(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("policy_team_%d", ts)
+	author := fmt.Sprintf("policy_author_%d", ts)
+	reviewer1 := fmt.Sprintf("policy_user1_%d", ts)
+	reviewer2 := fmt.Sprintf("policy_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": reviewer1, "username": "P1", "is_active": true},
+			{"user_id": reviewer2, "username": "P2", "is_active": true},
+		},
+		"merge_policy": map[string]interface{}{
+			"min_approvals":              2,
+			"block_on_changes_requested": true,
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("policy_pr_%d", ts)
+	createPRAndGetReviewers(t, prID, author)
+	mergeJSON, _ := json.Marshal(map[string]string{"pull_request_id": prID})
+
+	submitReview(t, prID, reviewer1, "APPROVED", http.StatusOK)
+	submitReview(t, prID, reviewer2, "CHANGES_REQUESTED", http.StatusOK)
+
+	resp = makeRequest(t, "POST", "/pullRequest/merge", mergeJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/merge with unmet policy: Expected 409, got %d", resp.StatusCode)
+	}
+	var errorResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	checkErrorCode(t, errorResponse, "MERGE_BLOCKED")
+	if unmet := errorResponse["error"].(map[string]interface{})["unmet"].([]interface{}); len(unmet) != 2 {
+		t.Errorf("Expected 2 unmet conditions, got %v", unmet)
+	}
+	closeBody(t, resp)
+
+	// После одобрения вторым ревьювером мерж проходит
+	submitReview(t, prID, reviewer2, "APPROVED", http.StatusOK)
+
+	resp = makeRequest(t, "POST", "/pullRequest/merge", mergeJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST /pullRequest/merge with met policy: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Политика с отрицательным порогом или неизвестным пользователем не принимается
+	for _, policy := range []map[string]interface{}{
+		{"min_approvals": -1},
+		{"min_approvals": 1, "required_group": []string{"nonexistent_" + reviewer1}},
+		{"min_approvals": 1, "required_group": []string{""}},
+	} {
+		policyJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "merge_policy": policy})
+		resp = makeRequest(t, "POST", "/team/setMergePolicy", policyJSON)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST /team/setMergePolicy %v: Expected 400, got %d", policy, resp.StatusCode)
+		}
+		closeBody(t, resp)
+	}
+}
+
+func testNeedMoreReviewers(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("topup_team_%d", ts)
+	author := fmt.Sprintf("topup_author_%d", ts)
+	reviewer := fmt.Sprintf("topup_user1_%d", ts)
+	sleeper := fmt.Sprintf("topup_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": reviewer, "username": "T1", "is_active": true},
+			{"user_id": sleeper, "username": "T2", "is_active": false},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("topup_pr_%d", ts)
+	prData := map[string]string{
+		"pull_request_id":   prID,
+		"pull_request_name": "Top up",
+		"author_id":         author,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+	}
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+
+	if createResponse["pr"].(map[string]interface{})["need_more_reviewers"] != true {
+		t.Error("PR with 1 reviewer should need more reviewers")
+	}
+
+	// Активация участника добирает его в PR
+	userData := map[string]interface{}{"user_id": sleeper, "is_active": true}
+	userJSON, _ := json.Marshal(userData)
+
+	resp = makeRequest(t, "POST", "/users/setIsActive", userJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /users/setIsActive: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	if !reviewQueueContains(t, sleeper, prID) {
+		t.Error("Activated user should be added to PR that needs more reviewers")
+	}
+
+	// Добирать больше некого, флаг снят
+	addJSON, _ := json.Marshal(map[string]string{"pull_request_id": prID})
+	resp = makeRequest(t, "POST", "/pullRequest/addReviewers", addJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/addReviewers: Expected 200, got %d", resp.StatusCode)
+	}
+	var addResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &addResponse)
+	closeBody(t, resp)
+
+	pr := addResponse["pr"].(map[string]interface{})
+	if pr["need_more_reviewers"] != false || len(pr["assigned_reviewers"].([]interface{})) != 2 {
+		t.Errorf("Expected PR with 2 reviewers and no need for more, got %v", pr)
+	}
+}
+
+func testReviewersCount(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("count_team_%d", ts)
+	author := fmt.Sprintf("count_author_%d", ts)
+
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 4; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("count_user%d_%d", i, ts), "username": fmt.Sprintf("C%d", i), "is_active": true,
+		})
+	}
+	teamData := map[string]interface{}{
+		"team_name":       teamName,
+		"reviewers_count": 3,
+		"members":         members,
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Значение команды по умолчанию
+	if reviewers := createPRAndGetReviewers(t, fmt.Sprintf("count_pr1_%d", ts), author); len(reviewers) != 3 {
+		t.Errorf("Expected 3 reviewers from team default, got %d", len(reviewers))
+	}
+
+	// Переопределение на уровне PR
+	prData := map[string]interface{}{
+		"pull_request_id":   fmt.Sprintf("count_pr2_%d", ts),
+		"pull_request_name": "Docs",
+		"author_id":         author,
+		"reviewers_count":   1,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create with reviewers_count: Expected 201, got %d", resp.StatusCode)
+	}
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+	if reviewers := createResponse["pr"].(map[string]interface{})["assigned_reviewers"].([]interface{}); len(reviewers) != 1 {
+		t.Errorf("Expected 1 reviewer from override, got %d", len(reviewers))
+	}
+
+	// Больше, чем участников в команде
+	prData["pull_request_id"] = fmt.Sprintf("count_pr3_%d", ts)
+	prData["reviewers_count"] = 5
+	prJSON, _ = json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /pullRequest/create with too many reviewers: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testFallbackTeams(t *testing.T) {
+	ts := time.Now().UnixNano()
+	backupTeam := fmt.Sprintf("backup_team_%d", ts)
+	homeTeam := fmt.Sprintf("home_team_%d", ts)
+	author := fmt.Sprintf("home_author_%d", ts)
+	backup1 := fmt.Sprintf("backup_user1_%d", ts)
+	backup2 := fmt.Sprintf("backup_user2_%d", ts)
+
+	teams := []map[string]interface{}{
+		{
+			"team_name": backupTeam,
+			"members": []map[string]interface{}{
+				{"user_id": backup1, "username": "B1", "is_active": true},
+				{"user_id": backup2, "username": "B2", "is_active": true},
+			},
+		},
+		{
+			"team_name":      homeTeam,
+			"fallback_teams": []string{backupTeam},
+			"members": []map[string]interface{}{
+				{"user_id": author, "username": "Author", "is_active": true},
+				{"user_id": fmt.Sprintf("home_user1_%d", ts), "username": "H1", "is_active": false},
+			},
+		},
+	}
+	for _, teamData := range teams {
+		teamJSON, _ := json.Marshal(teamData)
+		resp := makeRequest(t, "POST", "/team/add", teamJSON)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /team/add %s: Expected 201, got %d", teamData["team_name"], resp.StatusCode)
+		}
+		closeBody(t, resp)
+	}
+
+	prData := map[string]string{
+		"pull_request_id":   fmt.Sprintf("fallback_pr_%d", ts),
+		"pull_request_name": "Holiday fix",
+		"author_id":         author,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp := makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+	}
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+
+	pr := createResponse["pr"].(map[string]interface{})
+	if len(pr["assigned_reviewers"].([]interface{})) != 2 {
+		t.Errorf("Expected 2 reviewers from fallback team, got %v", pr["assigned_reviewers"])
+	}
+	fallback, _ := pr["fallback_reviewers"].([]interface{})
+	if len(fallback) != 2 {
+		t.Errorf("Expected both reviewers marked as fallback, got %v", pr["fallback_reviewers"])
+	}
+
+	// Ревьювер из резервной команды заменяется участником команды автора, когда тот доступен
+	homeUser := fmt.Sprintf("home_user1_%d", ts)
+	userJSON, _ := json.Marshal(map[string]interface{}{"user_id": homeUser, "is_active": true})
+	resp = makeRequest(t, "POST", "/users/setIsActive", userJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /users/setIsActive: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	reassignJSON, _ := json.Marshal(map[string]string{
+		"pull_request_id": fmt.Sprintf("fallback_pr_%d", ts),
+		"old_user_id":     backup1,
+	})
+	resp = makeRequest(t, "POST", "/pullRequest/reassign", reassignJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/reassign: Expected 200, got %d", resp.StatusCode)
+	}
+	var reassignResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reassignResponse)
+	closeBody(t, resp)
+	if reassignResponse["replaced_by"] != homeUser {
+		t.Errorf("Expected %s from the author's team, got %v", homeUser, reassignResponse["replaced_by"])
+	}
+
+	// Команда не может быть резервной для самой себя
+	selfJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name":      homeTeam,
+		"fallback_teams": []string{homeTeam},
+	})
+	resp = makeRequest(t, "POST", "/team/setFallbackTeams", selfJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /team/setFallbackTeams with itself: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testOwnershipRules(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("owners_team_%d", ts)
+	author := fmt.Sprintf("owners_author_%d", ts)
+	docsOwner := fmt.Sprintf("owners_docs_%d", ts)
+
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+		{"user_id": docsOwner, "username": "Docs", "is_active": true},
+	}
+	for i := 1; i <= 4; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("owners_user%d_%d", i, ts), "username": fmt.Sprintf("O%d", i), "is_active": true,
+		})
+	}
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members":   members,
+		"ownership_rules": []map[string]interface{}{
+			{"pattern": "/docs/", "users": []string{docsOwner}},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Владелец docs/ назначается всегда
+	for i := 0; i < 3; i++ {
+		prData := map[string]interface{}{
+			"pull_request_id":   fmt.Sprintf("owners_pr%d_%d", i, ts),
+			"pull_request_name": "Docs",
+			"author_id":         author,
+			"changed_files":     []string{"docs/guide/intro.md"},
+		}
+		prJSON, _ := json.Marshal(prData)
+
+		resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+		}
+		var createResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &createResponse)
+		closeBody(t, resp)
+
+		reviewers := createResponse["pr"].(map[string]interface{})["assigned_reviewers"].([]interface{})
+		if len(reviewers) != 2 || reviewers[0] != docsOwner {
+			t.Errorf("Expected docs owner as the first of 2 reviewers, got %v", reviewers)
+		}
+	}
+
+	// Владелец из другой команды проверяется по лимиту своей команды
+	extTeam := fmt.Sprintf("owners_ext_team_%d", ts)
+	extAuthor := fmt.Sprintf("owners_ext_author_%d", ts)
+	extOwner := fmt.Sprintf("owners_ext_owner_%d", ts)
+	teamJSON, _ = json.Marshal(map[string]interface{}{
+		"team_name":        extTeam,
+		"reviewers_count":  1,
+		"max_open_reviews": 1,
+		"members": []map[string]interface{}{
+			{"user_id": extAuthor, "username": "ExtAuthor", "is_active": true},
+			{"user_id": extOwner, "username": "ExtOwner", "is_active": true},
+		},
+	})
+	resp = makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+	if reviewers := createPRAndGetReviewers(t, fmt.Sprintf("owners_ext_pr_%d", ts), extAuthor); len(reviewers) != 1 || reviewers[0] != extOwner {
+		t.Fatalf("Expected %s as the only reviewer, got %v", extOwner, reviewers)
+	}
+
+	rulesJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name":       teamName,
+		"ownership_rules": []map[string]interface{}{{"pattern": "/api/", "users": []string{extOwner}}},
+	})
+	resp = makeRequest(t, "POST", "/team/setOwnershipRules", rulesJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setOwnershipRules: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prJSON, _ := json.Marshal(map[string]interface{}{
+		"pull_request_id":   fmt.Sprintf("owners_api_pr_%d", ts),
+		"pull_request_name": "API",
+		"author_id":         author,
+		"changed_files":     []string{"api/handler.go"},
+	})
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+	}
+	var apiResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &apiResponse)
+	closeBody(t, resp)
+	for _, r := range apiResponse["pr"].(map[string]interface{})["assigned_reviewers"].([]interface{}) {
+		if r == extOwner {
+			t.Errorf("Owner %s at the capacity of their team was assigned", extOwner)
+		}
+	}
+
+	// Правило без владельцев
+	rulesJSON, _ = json.Marshal(map[string]interface{}{
+		"team_name":       teamName,
+		"ownership_rules": []map[string]interface{}{{"pattern": "*.go"}},
+	})
+	resp = makeRequest(t, "POST", "/team/setOwnershipRules", rulesJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /team/setOwnershipRules without owners: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testAbsence(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("absence_team_%d", ts)
+	author := fmt.Sprintf("absence_author_%d", ts)
+
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 3; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("absence_user%d_%d", i, ts), "username": fmt.Sprintf("A%d", i), "is_active": true,
+		})
+	}
+	teamData := map[string]interface{}{
+		"team_name":       teamName,
+		"reviewers_count": 1,
+		"members":         members,
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("absence_pr_%d", ts)
+	reviewers := createPRAndGetReviewers(t, prID, author)
+	if len(reviewers) != 1 {
+		t.Fatalf("Expected 1 reviewer, got %v", reviewers)
+	}
+	absent := reviewers[0]
+
+	// Отсутствие уже началось: ревью переназначаются сразу
+	now := time.Now().UTC()
+	absenceData := map[string]interface{}{
+		"user_id": absent,
+		"start":   now.Add(-time.Hour).Format(time.RFC3339),
+		"end":     now.Add(24 * time.Hour).Format(time.RFC3339),
+	}
+	absenceJSON, _ := json.Marshal(absenceData)
+
+	resp = makeRequest(t, "POST", "/users/setAbsence", absenceJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /users/setAbsence: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	if reviewQueueContains(t, absent, prID) {
+		t.Error("Absent user should be replaced on open PR")
+	}
+	for i := 0; i < 3; i++ {
+		for _, r := range createPRAndGetReviewers(t, fmt.Sprintf("absence_pr%d_%d", i, ts), author) {
+			if r == absent {
+				t.Errorf("Absent user %s should not be assigned", absent)
+			}
+		}
+	}
+
+	// Конец раньше начала
+	absenceData["start"], absenceData["end"] = absenceData["end"], absenceData["start"]
+	absenceJSON, _ = json.Marshal(absenceData)
+
+	resp = makeRequest(t, "POST", "/users/setAbsence", absenceJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /users/setAbsence with end before start: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testCapacity(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("capacity_team_%d", ts)
+	author := fmt.Sprintf("capacity_author_%d", ts)
+	senior := fmt.Sprintf("capacity_senior_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name":        teamName,
+		"reviewers_count":  1,
+		"max_open_reviews": 1,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": senior, "username": "Senior", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	if reviewers := createPRAndGetReviewers(t, fmt.Sprintf("capacity_pr1_%d", ts), author); len(reviewers) != 1 {
+		t.Fatalf("Expected 1 reviewer, got %v", reviewers)
+	}
+
+	// Единственный кандидат упёрся в лимит команды
+	prData := map[string]string{
+		"pull_request_id":   fmt.Sprintf("capacity_pr2_%d", ts),
+		"pull_request_name": "Second",
+		"author_id":         author,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/create at capacity: Expected 409, got %d", resp.StatusCode)
+	}
+	var errorResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "AT_CAPACITY")
+
+	// Личный лимит перекрывает лимит команды
+	userJSON, _ := json.Marshal(map[string]interface{}{"user_id": senior, "max_open_reviews": 2})
+	resp = makeRequest(t, "POST", "/users/setMaxOpenReviews", userJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /users/setMaxOpenReviews: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("POST /pullRequest/create after raising limit: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Выбранный владелец остаётся, даже если вся команда упёрлась в лимит
+	ownerTeam := fmt.Sprintf("capacity_owner_team_%d", ts)
+	owner := fmt.Sprintf("capacity_owner_%d", ts)
+	teamJSON, _ = json.Marshal(map[string]interface{}{
+		"team_name": ownerTeam,
+		"members": []map[string]interface{}{
+			{"user_id": owner, "username": "Owner", "is_active": true},
+			{"user_id": fmt.Sprintf("capacity_owner_mate_%d", ts), "username": "OwnerMate", "is_active": true},
+		},
+	})
+	resp = makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	fullTeam := fmt.Sprintf("capacity_full_team_%d", ts)
+	fullAuthor := fmt.Sprintf("capacity_full_author_%d", ts)
+	mate := fmt.Sprintf("capacity_full_mate_%d", ts)
+	away := fmt.Sprintf("capacity_full_away_%d", ts)
+	teamJSON, _ = json.Marshal(map[string]interface{}{
+		"team_name":        fullTeam,
+		"reviewers_count":  1,
+		"max_open_reviews": 1,
+		"members": []map[string]interface{}{
+			{"user_id": fullAuthor, "username": "Author", "is_active": true},
+			{"user_id": mate, "username": "Mate", "is_active": true},
+			{"user_id": away, "username": "Away", "is_active": true},
+		},
+		"ownership_rules": []map[string]interface{}{
+			{"pattern": "/docs/", "users": []string{owner}},
+		},
+	})
+	resp = makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	now := time.Now().UTC()
+	absenceJSON, _ := json.Marshal(map[string]interface{}{
+		"user_id": away,
+		"start":   now.Add(-time.Hour).Format(time.RFC3339),
+		"end":     now.Add(24 * time.Hour).Format(time.RFC3339),
+	})
+	resp = makeRequest(t, "POST", "/users/setAbsence", absenceJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /users/setAbsence: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+	if reviewers := createPRAndGetReviewers(t, fmt.Sprintf("capacity_full_pr1_%d", ts), fullAuthor); len(reviewers) != 1 || reviewers[0] != mate {
+		t.Fatalf("Expected %s as the only reviewer, got %v", mate, reviewers)
+	}
+
+	prJSON, _ = json.Marshal(map[string]interface{}{
+		"pull_request_id":   fmt.Sprintf("capacity_full_pr2_%d", ts),
+		"pull_request_name": "Docs",
+		"author_id":         fullAuthor,
+		"reviewers_count":   2,
+		"changed_files":     []string{"docs/guide.md"},
+	})
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create with a full team: Expected 201, got %d", resp.StatusCode)
+	}
+	var partialResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &partialResponse)
+	closeBody(t, resp)
+
+	pr := partialResponse["pr"].(map[string]interface{})
+	reviewers := pr["assigned_reviewers"].([]interface{})
+	if len(reviewers) != 1 || reviewers[0] != owner || pr["need_more_reviewers"] != true {
+		t.Errorf("Expected the owner alone with need_more_reviewers, got %v", pr)
+	}
+}
+
+func testReviewRules(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("rules_team_%d", ts)
+	author := fmt.Sprintf("rules_author_%d", ts)
+	manager := fmt.Sprintf("rules_manager_%d", ts)
+	peer1 := fmt.Sprintf("rules_peer1_%d", ts)
+	peer2 := fmt.Sprintf("rules_peer2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name":       teamName,
+		"reviewers_count": 1,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": manager, "username": "Manager", "is_active": true},
+			{"user_id": peer1, "username": "P1", "is_active": true},
+			{"user_id": peer2, "username": "P2", "is_active": true},
+		},
+		"review_rules": map[string]interface{}{
+			"exclusions":               []map[string]string{{"reviewer_id": manager, "author_id": author}},
+			"max_consecutive_pairings": 1,
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Руководитель не назначается, а ревьюверы чередуются
+	prev := ""
+	for i := 0; i < 4; i++ {
+		reviewers := createPRAndGetReviewers(t, fmt.Sprintf("rules_pr%d_%d", i, ts), author)
+		if len(reviewers) != 1 {
+			t.Fatalf("Expected 1 reviewer, got %v", reviewers)
+		}
+		if reviewers[0] == manager {
+			t.Errorf("Excluded reviewer %s was assigned", manager)
+		}
+		if reviewers[0] == prev {
+			t.Errorf("Reviewer %s paired with the author twice in a row", prev)
+		}
+		prev = reviewers[0]
+	}
+
+	// Автор не может быть исключён сам для себя
+	rulesJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name": teamName,
+		"review_rules": map[string]interface{}{
+			"exclusions": []map[string]string{{"reviewer_id": author, "author_id": author}},
+		},
+	})
+	resp = makeRequest(t, "POST", "/team/setReviewRules", rulesJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /team/setReviewRules with self exclusion: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testSeededAssignment(t *testing.T) {
+	ts := time.Now().UnixNano()
+
+	// Выбор повторяется по зерну и кандидатам, записанным в решении
+	picks := make([][]string, 0, 2)
+	for _, prefix := range []string{"seed_a", "seed_b"} {
+		author := fmt.Sprintf("%s_%d_author", prefix, ts)
+		members := []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+		}
+		for i := 1; i <= 5; i++ {
+			members = append(members, map[string]interface{}{
+				"user_id": fmt.Sprintf("%s_%d_user%d", prefix, ts, i), "username": fmt.Sprintf("S%d", i), "is_active": true,
+			})
+		}
+		teamData := map[string]interface{}{
+			"team_name": fmt.Sprintf("%s_team_%d", prefix, ts),
+			"members":   members,
+		}
+		teamJSON, _ := json.Marshal(teamData)
+
+		resp := makeRequest(t, "POST", "/team/add", teamJSON)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+		}
+		closeBody(t, resp)
+
+		prID := fmt.Sprintf("%s_pr_%d", prefix, ts)
+		prData := map[string]interface{}{
+			"pull_request_id":   prID,
+			"pull_request_name": "Seeded",
+			"author_id":         author,
+		}
+		prJSON, _ := json.Marshal(prData)
+
+		resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+		}
+		var createResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &createResponse)
+		closeBody(t, resp)
+
+		var assigned, suffixes []string
+		for _, r := range createResponse["pr"].(map[string]interface{})["assigned_reviewers"].([]interface{}) {
+			assigned = append(assigned, r.(string))
+			suffixes = append(suffixes, strings.TrimPrefix(r.(string), fmt.Sprintf("%s_%d_", prefix, ts)))
+		}
+		picks = append(picks, suffixes)
+
+		resp = makeRequest(t, "GET", "/pullRequest/assignmentTrace?pull_request_id="+prID, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /pullRequest/assignmentTrace: Expected 200, got %d", resp.StatusCode)
+		}
+		// зерно int64 не помещается в float64, поэтому решение читается в структуру
+		var traceResponse struct {
+			Decisions []struct {
+				Action string `json:"action"`
+				Seed   int64  `json:"seed"`
+				Steps  []struct {
+					Pool       string   `json:"pool"`
+					Candidates []string `json:"candidates"`
+					Requested  int      `json:"requested"`
+				} `json:"steps"`
+			} `json:"decisions"`
+		}
+		parseAndCheckResponse(t, resp, &traceResponse)
+		closeBody(t, resp)
+
+		if len(traceResponse.Decisions) != 1 {
+			t.Fatalf("Expected 1 decision, got %d", len(traceResponse.Decisions))
+		}
+		decision := traceResponse.Decisions[0]
+		if decision.Action != "create" {
+			t.Errorf("Expected create decision, got %v", decision.Action)
+		}
+		// без правил владения шаг owners не записывается
+		if len(decision.Steps) != 1 || decision.Steps[0].Pool != "team" {
+			t.Fatalf("Expected a single team step, got %v", decision.Steps)
+		}
+
+		// стратегия random перемешивает кандидатов генератором с записанным зерном
+		step := decision.Steps[0]
+		candidates := step.Candidates
+		rand.New(rand.NewSource(decision.Seed)).Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		if step.Requested > len(candidates) || fmt.Sprint(candidates[:step.Requested]) != fmt.Sprint(assigned) {
+			t.Errorf("Expected replay with seed %d to pick %v, got %v", decision.Seed, assigned, candidates)
+		}
+	}
+
+	// Веса взвешенной стратегии записываются в шаг, чтобы его можно было повторить после их смены
+	strategyJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name":         fmt.Sprintf("seed_a_team_%d", ts),
+		"reviewer_strategy": "weighted",
+		"reviewer_weights":  map[string]int{fmt.Sprintf("seed_a_%d_user1", ts): 3},
+	})
+	resp := makeRequest(t, "POST", "/team/setReviewerStrategy", strategyJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setReviewerStrategy: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("seed_a_pr_%d", ts)
+	reassignJSON, _ := json.Marshal(map[string]string{
+		"pull_request_id": prID,
+		"old_user_id":     fmt.Sprintf("seed_a_%d_%s", ts, picks[0][0]),
+	})
+	resp = makeRequest(t, "POST", "/pullRequest/reassign", reassignJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/reassign: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = makeRequest(t, "GET", "/pullRequest/assignmentTrace?pull_request_id="+prID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pullRequest/assignmentTrace: Expected 200, got %d", resp.StatusCode)
+	}
+	var traceResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &traceResponse)
+	closeBody(t, resp)
+
+	decisions := traceResponse["decisions"].([]interface{})
+	if len(decisions) != 2 {
+		t.Fatalf("Expected 2 decisions, got %d", len(decisions))
+	}
+	step := decisions[1].(map[string]interface{})["steps"].([]interface{})[0].(map[string]interface{})
+	weights, _ := step["weights"].(map[string]interface{})
+	for _, c := range step["candidates"].([]interface{}) {
+		if _, ok := weights[c.(string)]; !ok {
+			t.Errorf("Expected a recorded weight for candidate %v, got %v", c, step["weights"])
+		}
+	}
+
+	// Курсор round_robin хранится в команде и записывается в шаг
+	strategyJSON, _ = json.Marshal(map[string]interface{}{
+		"team_name":         fmt.Sprintf("seed_b_team_%d", ts),
+		"reviewer_strategy": "round_robin",
+	})
+	resp = makeRequest(t, "POST", "/team/setReviewerStrategy", strategyJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setReviewerStrategy: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	author := fmt.Sprintf("seed_b_%d_author", ts)
+	first := createPRAndGetReviewers(t, fmt.Sprintf("seed_b_rr1_%d", ts), author)
+	if len(first) == 0 {
+		t.Fatal("Expected round_robin reviewers")
+	}
+	rrID := fmt.Sprintf("seed_b_rr2_%d", ts)
+	createPRAndGetReviewers(t, rrID, author)
+
+	resp = makeRequest(t, "GET", "/pullRequest/assignmentTrace?pull_request_id="+rrID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pullRequest/assignmentTrace: Expected 200, got %d", resp.StatusCode)
+	}
+	traceResponse = map[string]interface{}{}
+	parseAndCheckResponse(t, resp, &traceResponse)
+	closeBody(t, resp)
+
+	for _, item := range traceResponse["decisions"].([]interface{})[0].(map[string]interface{})["steps"].([]interface{}) {
+		step = item.(map[string]interface{})
+		if step["pool"] == "team" && step["cursor"] != first[len(first)-1] {
+			t.Errorf("Expected round_robin cursor %s, got %v", first[len(first)-1], step["cursor"])
+		}
+	}
+}
+
+func testConcurrentRoundRobin(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("rr_team_%d", ts)
+	author := fmt.Sprintf("rr_author_%d", ts)
+
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 4; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("rr_user%d_%d", i, ts), "username": fmt.Sprintf("R%d", i), "is_active": true,
+		})
+	}
+	teamJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name":         teamName,
+		"members":           members,
+		"reviewer_strategy": "round_robin",
+		"reviewers_count":   1,
+	})
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Параллельные создания читают курсор по очереди: каждый участник получает поровну
+	const prs = 8
+	codes := make([]int, prs)
+	var wg sync.WaitGroup
+	for i := 0; i < prs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prJSON, _ := json.Marshal(map[string]string{
+				"pull_request_id":   fmt.Sprintf("rr_pr%d_%d", i, ts),
+				"pull_request_name": "Concurrent",
+				"author_id":         author,
+			})
+			r, err := http.Post(getBaseURL()+"/pullRequest/create", "application/json", bytes.NewBuffer(prJSON))
+			if err != nil {
+				return
+			}
+			codes[i] = r.StatusCode
+			_ = r.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Fatalf("POST /pullRequest/create %d: Expected 201, got %d", i, code)
+		}
+	}
+
+	for i := 1; i <= 4; i++ {
+		userID := fmt.Sprintf("rr_user%d_%d", i, ts)
+		resp = makeRequest(t, "GET", "/users/getReview?user_id="+userID, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /users/getReview: Expected 200, got %d", resp.StatusCode)
+		}
+		var reviewsResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &reviewsResponse)
+		closeBody(t, resp)
+
+		if got := reviewsResponse["pull_requests"].([]interface{}); len(got) != prs/4 {
+			t.Errorf("Expected %d reviews for %s, got %d", prs/4, userID, len(got))
+		}
+	}
+}
+
+func testSimulation(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("sim_team_%d", ts)
+	author := fmt.Sprintf("sim_author_%d", ts)
+
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 4; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("sim_user%d_%d", i, ts), "username": fmt.Sprintf("M%d", i), "is_active": true,
+		})
+	}
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members":   members,
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prs := make([]map[string]string, 0, 8)
+	for i := 0; i < 8; i++ {
+		prs = append(prs, map[string]string{"author_id": author})
+	}
+	simData := map[string]interface{}{
+		"team_name":     teamName,
+		"policy":        map[string]interface{}{"reviewer_strategy": "round_robin", "reviewers_count": 1},
+		"pull_requests": prs,
+	}
+	simJSON, _ := json.Marshal(simData)
+
+	resp = makeRequest(t, "POST", "/simulate/assignments", simJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /simulate/assignments: Expected 200, got %d", resp.StatusCode)
+	}
+	var simResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &simResponse)
+	closeBody(t, resp)
+
+	// Round robin делит 8 PR поровну между 4 участниками
+	distribution := simResponse["distribution"].(map[string]interface{})
+	if len(distribution) != 4 {
+		t.Errorf("Expected distribution over 4 members, got %v", distribution)
+	}
+	for user, n := range distribution {
+		if n != float64(2) {
+			t.Errorf("Expected 2 simulated reviews for %s, got %v", user, n)
+		}
+	}
+	if simResponse["stddev"] != float64(0) {
+		t.Errorf("Expected zero stddev, got %v", simResponse["stddev"])
+	}
+
+	// Моделирование ничего не записывает
+	resp = makeRequest(t, "GET", "/users/getReview?user_id="+fmt.Sprintf("sim_user1_%d", ts), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /users/getReview: Expected 200, got %d", resp.StatusCode)
+	}
+	var reviewsResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reviewsResponse)
+	closeBody(t, resp)
+	if prs := reviewsResponse["pull_requests"].([]interface{}); len(prs) != 0 {
+		t.Errorf("Simulation should not assign real reviews, got %v", prs)
+	}
+
+	// Ограничение подряд идущих пар моделируется так же, как при создании PR
+	rulesJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name":    teamName,
+		"review_rules": map[string]interface{}{"max_consecutive_pairings": 1},
+	})
+	resp = makeRequest(t, "POST", "/team/setReviewRules", rulesJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setReviewRules: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	simData["policy"] = map[string]interface{}{"reviewer_strategy": "random", "reviewers_count": 1}
+	simJSON, _ = json.Marshal(simData)
+	resp = makeRequest(t, "POST", "/simulate/assignments", simJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /simulate/assignments with review rules: Expected 200, got %d", resp.StatusCode)
+	}
+	simResponse = map[string]interface{}{}
+	parseAndCheckResponse(t, resp, &simResponse)
+	closeBody(t, resp)
+
+	prev := ""
+	for _, item := range simResponse["pull_requests"].([]interface{}) {
+		reviewers := item.(map[string]interface{})["reviewers"].([]interface{})
+		if len(reviewers) != 1 {
+			t.Fatalf("Expected 1 simulated reviewer, got %v", reviewers)
+		}
+		if reviewers[0] == prev {
+			t.Errorf("Simulated reviewer %v paired with the author twice in a row", prev)
+		}
+		prev = reviewers[0].(string)
+	}
+
+	delete(simData, "pull_requests")
+	simJSON, _ = json.Marshal(simData)
+	resp = makeRequest(t, "POST", "/simulate/assignments", simJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /simulate/assignments without PRs: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testCloseReopen(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("close_team_%d", ts)
+	author := fmt.Sprintf("close_author_%d", ts)
+	user1 := fmt.Sprintf("close_user1_%d", ts)
+	user2 := fmt.Sprintf("close_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": user1, "username": "C1", "is_active": true},
+			{"user_id": user2, "username": "C2", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("close_pr_%d", ts)
+	createPRAndGetReviewers(t, prID, author)
+	prJSON, _ := json.Marshal(map[string]string{"pull_request_id": prID})
+
+	resp = makeRequest(t, "POST", "/pullRequest/close", prJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/close: Expected 200, got %d", resp.StatusCode)
+	}
+	var closeResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &closeResponse)
+	closeBody(t, resp)
+
+	pr := closeResponse["pr"].(map[string]interface{})
+	if pr["status"] != "CLOSED" || pr["closedAt"] == nil {
+		t.Errorf("Expected CLOSED PR with closedAt, got %v", pr)
+	}
+	if reviewQueueContains(t, user1, prID) {
+		t.Error("Closed PR should not be in the review queue")
+	}
+
+	// На закрытом PR нельзя ревьюить и мержить
+	submitReview(t, prID, user1, "APPROVED", http.StatusConflict)
+
+	resp = makeRequest(t, "POST", "/pullRequest/merge", prJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/merge on closed PR: Expected 409, got %d", resp.StatusCode)
+	}
+	var errorResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "INVALID_TRANSITION")
+
+	// Деактивированный ревьювер снимается при переоткрытии
+	userJSON, _ := json.Marshal(map[string]interface{}{"user_id": user1, "is_active": false})
+	resp = makeRequest(t, "POST", "/users/setIsActive", userJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /users/setIsActive: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = makeRequest(t, "POST", "/pullRequest/reopen", prJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/reopen: Expected 200, got %d", resp.StatusCode)
+	}
+	var reopenResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reopenResponse)
+	closeBody(t, resp)
+
+	pr = reopenResponse["pr"].(map[string]interface{})
+	removed := reopenResponse["removed"].([]interface{})
+	if pr["status"] != "OPEN" || len(removed) != 1 || removed[0] != user1 {
+		t.Errorf("Expected OPEN PR with %s removed, got %v, removed %v", user1, pr, removed)
+	}
+	reviewers := pr["assigned_reviewers"].([]interface{})
+	if len(reviewers) != 1 || reviewers[0] != user2 || pr["need_more_reviewers"] != true {
+		t.Errorf("Expected only %s left and need_more_reviewers, got %v", user2, pr)
+	}
+	if !reviewQueueContains(t, user2, prID) {
+		t.Error("Reopened PR should be back in the review queue")
+	}
+
+	resp = makeRequest(t, "POST", "/pullRequest/merge", prJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/merge: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// MERGED окончательный
+	resp = makeRequest(t, "POST", "/pullRequest/close", prJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/close on merged PR: Expected 409, got %d", resp.StatusCode)
+	}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "INVALID_TRANSITION")
+}
+
+func testDraftPR(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("draft_team_%d", ts)
+	author := fmt.Sprintf("draft_author_%d", ts)
+	user1 := fmt.Sprintf("draft_user1_%d", ts)
+	user2 := fmt.Sprintf("draft_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": user1, "username": "D1", "is_active": true},
+			{"user_id": user2, "username": "D2", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("draft_pr_%d", ts)
+	prData := map[string]interface{}{
+		"pull_request_id":   prID,
+		"pull_request_name": "WIP",
+		"author_id":         author,
+		"draft":             true,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+	}
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+
+	pr := createResponse["pr"].(map[string]interface{})
+	if pr["draft"] != true || len(pr["assigned_reviewers"].([]interface{})) != 0 || pr["need_more_reviewers"] != false {
+		t.Errorf("Expected draft PR without reviewers, got %v", pr)
+	}
+	if reviewQueueContains(t, user1, prID) || reviewQueueContains(t, user2, prID) {
+		t.Error("Draft PR should not be in any review queue")
+	}
+
+	// Черновик нельзя смержить
+	idJSON, _ := json.Marshal(map[string]string{"pull_request_id": prID})
+	resp = makeRequest(t, "POST", "/pullRequest/merge", idJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/merge on draft: Expected 409, got %d", resp.StatusCode)
+	}
+	var errorResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "PR_DRAFT")
+
+	resp = makeRequest(t, "POST", "/pullRequest/markReady", idJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/markReady: Expected 200, got %d", resp.StatusCode)
+	}
+	var readyResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &readyResponse)
+	closeBody(t, resp)
+
+	pr = readyResponse["pr"].(map[string]interface{})
+	if pr["draft"] != false || len(pr["assigned_reviewers"].([]interface{})) != 2 {
+		t.Errorf("Expected ready PR with 2 reviewers, got %v", pr)
+	}
+	if !reviewQueueContains(t, user1, prID) || !reviewQueueContains(t, user2, prID) {
+		t.Error("Ready PR should be in the reviewers' queues")
+	}
+
+	// Повторный markReady ничего не меняет
+	resp = makeRequest(t, "POST", "/pullRequest/markReady", idJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/markReady again: Expected 200, got %d", resp.StatusCode)
+	}
+	parseAndCheckResponse(t, resp, &readyResponse)
+	closeBody(t, resp)
+
+	if n := len(readyResponse["pr"].(map[string]interface{})["assigned_reviewers"].([]interface{})); n != 2 {
+		t.Errorf("Expected reviewers unchanged, got %d", n)
+	}
+}
+
+func testPRMetadata(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("meta_team_%d", ts)
+	author := fmt.Sprintf("meta_author_%d", ts)
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 3; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("meta_user%d_%d", i, ts), "username": fmt.Sprintf("M%d", i), "is_active": true,
+		})
+	}
+	teamJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "members": members})
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	linesJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "large_pr_lines": 500})
+	resp = makeRequest(t, "POST", "/team/setLargePRLines", linesJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setLargePRLines: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	repo := fmt.Sprintf("meta_repo_%d", ts)
+	prID := fmt.Sprintf("meta_pr_%d", ts)
+	prData := map[string]interface{}{
+		"pull_request_id":   prID,
+		"pull_request_name": "Metadata",
+		"author_id":         author,
+		"repository":        repo,
+		"target_branch":     "main",
+		"labels":            []string{"backend"},
+		"priority":          "high",
+		"additions":         10,
+		"deletions":         5,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp = makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create: Expected 201, got %d", resp.StatusCode)
+	}
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+
+	pr := createResponse["pr"].(map[string]interface{})
+	if pr["repository"] != repo || pr["priority"] != "high" || len(pr["assigned_reviewers"].([]interface{})) != 2 {
+		t.Errorf("Expected small PR with metadata and 2 reviewers, got %v", pr)
+	}
+	reviewer := pr["assigned_reviewers"].([]interface{})[0].(string)
+
+	// Фильтры очереди ревью
+	if !reviewQueueContains(t, reviewer+"&label=backend&priority=high&repository="+repo, prID) {
+		t.Error("Review queue filtered by matching metadata should contain the PR")
+	}
+	if reviewQueueContains(t, reviewer+"&label=frontend", prID) {
+		t.Error("Review queue filtered by another label should not contain the PR")
+	}
+
+	// Рост PR добавляет ревьювера
+	updateJSON, _ := json.Marshal(map[string]interface{}{"pull_request_id": prID, "additions": 600})
+	resp = makeRequest(t, "POST", "/pullRequest/update", updateJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/update: Expected 200, got %d", resp.StatusCode)
+	}
+	var updateResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &updateResponse)
+	closeBody(t, resp)
+
+	pr = updateResponse["pr"].(map[string]interface{})
+	if len(updateResponse["added"].([]interface{})) != 1 || len(pr["assigned_reviewers"].([]interface{})) != 3 {
+		t.Errorf("Expected an extra reviewer for large PR, got %v", updateResponse)
+	}
+	if pr["labels"].([]interface{})[0] != "backend" || pr["target_branch"] != "main" {
+		t.Errorf("Fields absent from update should be kept, got %v", pr)
+	}
+
+	invalidJSON, _ := json.Marshal(map[string]interface{}{"pull_request_id": prID, "priority": "asap"})
+	resp = makeRequest(t, "POST", "/pullRequest/update", invalidJSON)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /pullRequest/update with unknown priority: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	// Изменение PR без роста не добирает недостающих ревьюверов
+	now := time.Now().UTC()
+	for i := 2; i <= 3; i++ {
+		absenceJSON, _ := json.Marshal(map[string]interface{}{
+			"user_id": fmt.Sprintf("meta_user%d_%d", i, ts),
+			"start":   now.Add(-time.Hour).Format(time.RFC3339),
+			"end":     now.Add(24 * time.Hour).Format(time.RFC3339),
+		})
+		resp = makeRequest(t, "POST", "/users/setAbsence", absenceJSON)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /users/setAbsence: Expected 201, got %d", resp.StatusCode)
+		}
+		closeBody(t, resp)
+	}
+	shortID := fmt.Sprintf("meta_short_pr_%d", ts)
+	if reviewers := createPRAndGetReviewers(t, shortID, author); len(reviewers) != 1 {
+		t.Fatalf("Expected 1 available reviewer, got %v", reviewers)
+	}
+	// новый участник мог бы занять свободное место
+	addJSON, _ := json.Marshal(map[string]interface{}{
+		"team_name": teamName,
+		"user_id":   fmt.Sprintf("meta_newcomer_%d", ts),
+		"username":  "Newcomer",
+		"is_active": true,
+	})
+	resp = makeRequest(t, "POST", "/team/addMember", addJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/addMember: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+	renameJSON, _ := json.Marshal(map[string]interface{}{"pull_request_id": shortID, "pull_request_name": "Renamed"})
+	resp = makeRequest(t, "POST", "/pullRequest/update", renameJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/update: Expected 200, got %d", resp.StatusCode)
+	}
+	updateResponse = map[string]interface{}{}
+	parseAndCheckResponse(t, resp, &updateResponse)
+	closeBody(t, resp)
+	if added := updateResponse["added"].([]interface{}); len(added) != 0 {
+		t.Errorf("Rename should not add reviewers, got %v", added)
+	}
+}
+
+func testReviewSLA(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("sla_team_%d", ts)
+	author := fmt.Sprintf("sla_author_%d", ts)
+	user1 := fmt.Sprintf("sla_user1_%d", ts)
+	user2 := fmt.Sprintf("sla_user2_%d", ts)
+
+	teamData := map[string]interface{}{
+		"team_name": teamName,
+		"members": []map[string]interface{}{
+			{"user_id": author, "username": "Author", "is_active": true},
+			{"user_id": user1, "username": "S1", "is_active": true},
+			{"user_id": user2, "username": "S2", "is_active": true},
+		},
+	}
+	teamJSON, _ := json.Marshal(teamData)
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	slaJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "review_sla_hours": 1})
+	resp = makeRequest(t, "POST", "/team/setReviewSLA", slaJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /team/setReviewSLA: Expected 200, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("sla_pr_%d", ts)
+	if reviewers := createPRAndGetReviewers(t, prID, author); len(reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", reviewers)
+	}
+
+	overdue := func(at time.Time) []interface{} {
+		resp := makeRequest(t, "GET", "/pullRequest/overdue?team_name="+teamName+"&at="+at.UTC().Format(time.RFC3339), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /pullRequest/overdue: Expected 200, got %d", resp.StatusCode)
+		}
+		var overdueResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &overdueResponse)
+		closeBody(t, resp)
+		return overdueResponse["reviews"].([]interface{})
+	}
+
+	if reviews := overdue(time.Now()); len(reviews) != 0 {
+		t.Errorf("Fresh PR should have no overdue reviews, got %v", reviews)
+	}
+	if reviews := overdue(time.Now().Add(2 * time.Hour)); len(reviews) != 2 {
+		t.Errorf("Expected both reviews overdue in 2 hours, got %v", reviews)
+	}
+
+	// Вынесенное решение снимает просрочку
+	submitReview(t, prID, user1, "APPROVED", http.StatusOK)
+
+	reviews := overdue(time.Now().Add(2 * time.Hour))
+	if len(reviews) != 1 || reviews[0].(map[string]interface{})["reviewer_id"] != user2 {
+		t.Errorf("Expected only %s overdue, got %v", user2, reviews)
+	}
+
+	resp = makeRequest(t, "GET", "/pullRequest/overdue?team_name=nonexistent_team_"+teamName, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /pullRequest/overdue for unknown team: Expected 404, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testAssignmentHistory(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("hist_team_%d", ts)
+	author := fmt.Sprintf("hist_author_%d", ts)
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 3; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id": fmt.Sprintf("hist_user%d_%d", i, ts), "username": fmt.Sprintf("H%d", i), "is_active": true,
+		})
+	}
+	teamJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "members": members})
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("hist_pr_%d", ts)
+	reviewers := createPRAndGetReviewers(t, prID, author)
+	if len(reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", reviewers)
+	}
+
+	reassignJSON, _ := json.Marshal(map[string]string{"pull_request_id": prID, "old_user_id": reviewers[0]})
+	resp = makeRequest(t, "POST", "/pullRequest/reassign", reassignJSON)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/reassign: Expected 200, got %d", resp.StatusCode)
+	}
+	var reassignResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reassignResponse)
+	closeBody(t, resp)
+	replacedBy := reassignResponse["replaced_by"]
+
+	resp = makeRequest(t, "GET", "/pullRequest/history?pull_request_id="+prID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pullRequest/history: Expected 200, got %d", resp.StatusCode)
+	}
+	var historyResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &historyResponse)
+	closeBody(t, resp)
+
+	events := historyResponse["events"].([]interface{})
+	if len(events) != 4 {
+		t.Fatalf("Expected 2 assigned, 1 replaced and 1 assigned events, got %v", events)
+	}
+	for _, e := range events[:2] {
+		event := e.(map[string]interface{})
+		if event["type"] != "assigned" || event["reason"] != "pr_created" || event["actor"] != "api" {
+			t.Errorf("Expected assigned event on create, got %v", event)
+		}
+	}
+	replaced := events[2].(map[string]interface{})
+	if replaced["type"] != "replaced" || replaced["reviewer_id"] != reviewers[0] ||
+		replaced["replaced_by"] != replacedBy || replaced["reason"] != "reassigned" {
+		t.Errorf("Expected %s replaced by %v, got %v", reviewers[0], replacedBy, replaced)
+	}
+	assigned := events[3].(map[string]interface{})
+	if assigned["type"] != "assigned" || assigned["reviewer_id"] != replacedBy {
+		t.Errorf("Expected %v assigned, got %v", replacedBy, assigned)
+	}
+
+	resp = makeRequest(t, "GET", "/pullRequest/history?pull_request_id=nonexistent_"+prID, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /pullRequest/history for unknown PR: Expected 404, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func testReassignToUser(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("handoff_team_%d", ts)
+	author := fmt.Sprintf("handoff_author_%d", ts)
+	users := make([]string, 0, 3)
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("handoff_user%d_%d", i, ts)
+		users = append(users, id)
+		members = append(members, map[string]interface{}{"user_id": id, "username": fmt.Sprintf("R%d", i), "is_active": true})
+	}
+	teamJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "members": members})
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("handoff_pr_%d", ts)
+	reviewers := createPRAndGetReviewers(t, prID, author)
+	if len(reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", reviewers)
+	}
+	free := ""
+	for _, u := range users {
+		if u != reviewers[0] && u != reviewers[1] {
+			free = u
+		}
+	}
+
+	reassign := func(newUserID, reason string) *http.Response {
+		body, _ := json.Marshal(map[string]string{
+			"pull_request_id": prID,
+			"old_user_id":     reviewers[0],
+			"new_user_id":     newUserID,
+			"reason":          reason,
+		})
+		return makeRequest(t, "POST", "/pullRequest/reassign", body)
+	}
+
+	// Автор и уже назначенный ревьювер не подходят
+	for _, newUserID := range []string{author, reviewers[1]} {
+		resp = reassign(newUserID, "")
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("POST /pullRequest/reassign to %s: Expected 409, got %d", newUserID, resp.StatusCode)
+		}
+		var errorResponse map[string]interface{}
+		parseAndCheckResponse(t, resp, &errorResponse)
+		closeBody(t, resp)
+		checkErrorCode(t, errorResponse, "NOT_ELIGIBLE")
+	}
+
+	resp = reassign("nonexistent_"+free, "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST /pullRequest/reassign to unknown user: Expected 404, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	reason := "knows the code"
+	resp = reassign(free, reason)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/reassign: Expected 200, got %d", resp.StatusCode)
+	}
+	var reassignResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reassignResponse)
+	closeBody(t, resp)
+
+	if reassignResponse["replaced_by"] != free || reassignResponse["reason"] != reason {
+		t.Errorf("Expected handoff to %s with reason, got %v", free, reassignResponse)
+	}
+
+	resp = makeRequest(t, "GET", "/pullRequest/history?pull_request_id="+prID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pullRequest/history: Expected 200, got %d", resp.StatusCode)
+	}
+	var historyResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &historyResponse)
+	closeBody(t, resp)
+
+	events := historyResponse["events"].([]interface{})
+	replaced := events[len(events)-2].(map[string]interface{})
+	if replaced["type"] != "replaced" || replaced["replaced_by"] != free || replaced["reason"] != reason {
+		t.Errorf("Expected the handoff reason in history, got %v", replaced)
+	}
+}
+
+func testDeclineReview(t *testing.T) {
+	ts := time.Now().UnixNano()
+	teamName := fmt.Sprintf("decline_team_%d", ts)
+	author := fmt.Sprintf("decline_author_%d", ts)
+	members := []map[string]interface{}{
+		{"user_id": author, "username": "Author", "is_active": true},
+	}
+	for i := 1; i <= 3; i++ {
+		members = append(members, map[string]interface{}{
+			"user_id":   fmt.Sprintf("decline_user%d_%d", i, ts),
+			"username":  fmt.Sprintf("R%d", i),
+			"is_active": true,
+		})
+	}
+	teamJSON, _ := json.Marshal(map[string]interface{}{"team_name": teamName, "members": members})
+
+	resp := makeRequest(t, "POST", "/team/add", teamJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /team/add: Expected 201, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	prID := fmt.Sprintf("decline_pr_%d", ts)
+	reviewers := createPRAndGetReviewers(t, prID, author)
+	if len(reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", reviewers)
+	}
+
+	decline := func(userID, reason string) *http.Response {
+		body, _ := json.Marshal(map[string]string{
+			"pull_request_id": prID,
+			"user_id":         userID,
+			"reason":          reason,
+		})
+		return makeRequest(t, "POST", "/pullRequest/decline", body)
+	}
+
+	resp = decline(reviewers[0], "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /pullRequest/decline without reason: Expected 400, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	resp = decline(author, "not mine")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /pullRequest/decline by author: Expected 409, got %d", resp.StatusCode)
+	}
+	closeBody(t, resp)
+
+	reason := "busy this week"
+	resp = decline(reviewers[0], reason)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /pullRequest/decline: Expected 200, got %d", resp.StatusCode)
+	}
+	var declineResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &declineResponse)
+	closeBody(t, resp)
+
+	replacement, _ := declineResponse["replaced_by"].(string)
+	if replacement == "" || replacement == reviewers[0] || replacement == reviewers[1] {
+		t.Errorf("Expected a new reviewer, got %v", declineResponse["replaced_by"])
+	}
+	pr := declineResponse["pr"].(map[string]interface{})
+	declined, _ := pr["declined_reviewers"].([]interface{})
+	if len(declined) != 1 || declined[0] != reviewers[0] {
+		t.Errorf("Expected %s in declined_reviewers, got %v", reviewers[0], pr["declined_reviewers"])
+	}
+
+	// Вернуть отказавшегося нельзя ни по new_user_id, ни случайным выбором
+	reassignJSON, _ := json.Marshal(map[string]string{
+		"pull_request_id": prID,
+		"old_user_id":     replacement,
+		"new_user_id":     reviewers[0],
+	})
+	resp = makeRequest(t, "POST", "/pullRequest/reassign", reassignJSON)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/reassign to declined reviewer: Expected 409, got %d", resp.StatusCode)
+	}
+	var errorResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "NOT_ELIGIBLE")
+
+	resp = decline(replacement, reason)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST /pullRequest/decline with no one left: Expected 409, got %d", resp.StatusCode)
+	}
+	parseAndCheckResponse(t, resp, &errorResponse)
+	closeBody(t, resp)
+	checkErrorCode(t, errorResponse, "NO_CANDIDATE")
+
+	resp = makeRequest(t, "GET", "/pullRequest/history?pull_request_id="+prID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pullRequest/history: Expected 200, got %d", resp.StatusCode)
+	}
+	var historyResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &historyResponse)
+	closeBody(t, resp)
+
+	events := historyResponse["events"].([]interface{})
+	replaced := events[len(events)-2].(map[string]interface{})
+	if replaced["type"] != "replaced" || replaced["actor"] != reviewers[0] || replaced["reason"] != reason {
+		t.Errorf("Expected the decline by %s in history, got %v", reviewers[0], replaced)
+	}
+}
+
+func submitReview(t *testing.T, prID, reviewerID, state string, expectedStatus int) {
+	reviewData := map[string]string{
+		"pull_request_id": prID,
+		"reviewer_id":     reviewerID,
+		"state":           state,
+	}
+	reviewJSON, _ := json.Marshal(reviewData)
+
+	resp := makeRequest(t, "POST", "/pullRequest/review", reviewJSON)
+	if resp.StatusCode != expectedStatus {
+		t.Errorf("POST /pullRequest/review %s by %s: Expected %d, got %d", state, reviewerID, expectedStatus, resp.StatusCode)
+	}
+	closeBody(t, resp)
+}
+
+func reviewQueueContains(t *testing.T, userID, prID string) bool {
+	resp := makeRequest(t, "GET", "/users/getReview?user_id="+userID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /users/getReview: Expected 200, got %d", resp.StatusCode)
+	}
+
+	var reviewsResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &reviewsResponse)
+	closeBody(t, resp)
+
+	for _, prShort := range reviewsResponse["pull_requests"].([]interface{}) {
+		if prShort.(map[string]interface{})["pull_request_id"] == prID {
+			return true
+		}
+	}
+	return false
+}
+
+func createPRAndGetReviewers(t *testing.T, prID, authorID string) []string {
+	prData := map[string]string{
+		"pull_request_id":   prID,
+		"pull_request_name": "PR " + prID,
+		"author_id":         authorID,
+	}
+	prJSON, _ := json.Marshal(prData)
+
+	resp := makeRequest(t, "POST", "/pullRequest/create", prJSON)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /pullRequest/create %s: Expected 201, got %d", prID, resp.StatusCode)
+	}
+
+	var createResponse map[string]interface{}
+	parseAndCheckResponse(t, resp, &createResponse)
+	closeBody(t, resp)
+
+	pr := createResponse["pr"].(map[string]interface{})
+	reviewers := make([]string, 0)
+	for _, r := range pr["assigned_reviewers"].([]interface{}) {
+		reviewers = append(reviewers, r.(string))
+	}
+	return reviewers
+}
+
 func closeBody(t *testing.T, resp *http.Response) {
 	if err := resp.Body.Close(); err != nil {
 		t.Logf("Failed to close response body: %v", err)
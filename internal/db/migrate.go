@@ -0,0 +1,59 @@
+package db
+
+import (
+	"pr_reviewer_service_go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func Migrate() error {
+	if err := DB.AutoMigrate(&models.User{}, &models.Team{}, &models.PullRequest{}, &models.Absence{}, &models.AssignmentEvent{},
+		&models.AssignmentDecision{}); err != nil {
+		return err
+	}
+	if err := dropTeamMembersColumn(); err != nil {
+		return err
+	}
+	return moveAssignmentTrace()
+}
+
+// dropTeamMembersColumn removes the legacy teams.members jsonb copy. Team
+// membership is read from users.team_name; members that only exist in the
+// jsonb copy are inserted into users first.
+func dropTeamMembersColumn() error {
+	if !DB.Migrator().HasColumn("teams", "members") {
+		return nil
+	}
+
+	err := DB.Exec(`
+		INSERT INTO users (user_id, username, is_active, team_name)
+		SELECT m->>'user_id', m->>'username', COALESCE((m->>'is_active')::boolean, true), t.team_name
+		FROM teams t, jsonb_array_elements(COALESCE(t.members, '[]'::jsonb)) AS m
+		ON CONFLICT (user_id) DO NOTHING`).Error
+	if err != nil {
+		return err
+	}
+
+	return DB.Migrator().DropColumn("teams", "members")
+}
+
+// moveAssignmentTrace moves the legacy pull_requests.assignment_trace jsonb
+// array into the assignment_decisions table, keeping the order, and drops the
+// column.
+func moveAssignmentTrace() error {
+	if !DB.Migrator().HasColumn("pull_requests", "assignment_trace") {
+		return nil
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO assignment_decisions (pull_request_id, action, seed, at, steps)
+			SELECT p.pull_request_id, d->>'action', (d->>'seed')::bigint, (d->>'at')::timestamptz, COALESCE(d->'steps', '[]'::jsonb)
+			FROM pull_requests p, jsonb_array_elements(COALESCE(p.assignment_trace, '[]'::jsonb)) WITH ORDINALITY AS t(d, pos)
+			ORDER BY p.pull_request_id, t.pos`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("pull_requests", "assignment_trace")
+	})
+}
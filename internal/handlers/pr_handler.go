@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"pr_reviewer_service_go/internal/models"
 	"pr_reviewer_service_go/internal/services"
@@ -18,21 +19,27 @@ func NewPullRequestHandler(s *services.PullRequestService) *PullRequestHandler {
 
 func (h *PullRequestHandler) PostPullRequestCreate(c *gin.Context) {
 	var req struct {
-		PullRequestID   string `json:"pull_request_id"`
-		PullRequestName string `json:"pull_request_name"`
-		AuthorID        string `json:"author_id"`
+		PullRequestID   string   `json:"pull_request_id"`
+		PullRequestName string   `json:"pull_request_name"`
+		AuthorID        string   `json:"author_id"`
+		ReviewersCount  *int     `json:"reviewers_count"`
+		ChangedFiles    []string `json:"changed_files"`
+		Draft           bool     `json:"draft"`
+		models.PullRequestMetadata
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	pr, err := h.svc.Create(req.PullRequestID, req.PullRequestName, req.AuthorID)
+	pr, err := h.svc.Create(req.PullRequestID, req.PullRequestName, req.AuthorID, req.ReviewersCount, req.ChangedFiles, req.PullRequestMetadata, req.Draft)
 	if err != nil {
 		switch err {
 		case models.ErrNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
 		case models.ErrPRExists:
 			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PREXISTS, "message": err.Error()}})
+		case models.ErrAtCapacity:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.ATCAPACITY, "message": err.Error()}})
 		default:
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		}
@@ -41,6 +48,32 @@ func (h *PullRequestHandler) PostPullRequestCreate(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"pr": pr})
 }
 
+func (h *PullRequestHandler) PostPullRequestUpdate(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		models.PullRequestUpdate
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	added, pr, err := h.svc.UpdatePullRequest(req.PullRequestID, req.PullRequestUpdate)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrUpdateMerged:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRMERGED, "message": err.Error()}})
+		case models.ErrInvalidMetadata:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr, "added": added})
+}
+
 func (h *PullRequestHandler) PostPullRequestMerge(c *gin.Context) {
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
@@ -55,36 +88,266 @@ func (h *PullRequestHandler) PostPullRequestMerge(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
 			return
 		}
+		if err == models.ErrInvalidTransition {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.INVALIDTRANSITION, "message": err.Error()}})
+			return
+		}
+		if err == models.ErrPRDraft {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRDRAFT, "message": err.Error()}})
+			return
+		}
+		var blocked *models.MergeBlockedError
+		if errors.As(err, &blocked) {
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.MERGEBLOCKED, "message": err.Error(), "unmet": blocked.Unmet}})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"pr": pr})
 }
 
+func (h *PullRequestHandler) PostPullRequestMarkReady(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pr, err := h.svc.MarkReady(req.PullRequestID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrPRClosed:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRCLOSED, "message": err.Error()}})
+		case models.ErrAtCapacity:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.ATCAPACITY, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr})
+}
+
+func (h *PullRequestHandler) PostPullRequestClose(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pr, err := h.svc.ClosePullRequest(req.PullRequestID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidTransition:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.INVALIDTRANSITION, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr})
+}
+
+func (h *PullRequestHandler) PostPullRequestReopen(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	removed, pr, err := h.svc.ReopenPullRequest(req.PullRequestID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidTransition:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.INVALIDTRANSITION, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr, "removed": removed})
+}
+
 func (h *PullRequestHandler) PostPullRequestReassign(c *gin.Context) {
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
 		OldUserID     string `json:"old_user_id"`
+		NewUserID     string `json:"new_user_id"`
+		Reason        string `json:"reason"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	newReviewer, pr, err := h.svc.ReassignReviewer(req.PullRequestID, req.OldUserID)
+	cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: req.Reason}
+	if cause.Reason == "" {
+		cause.Reason = models.ReasonReassigned
+	}
+	newReviewer, pr, err := h.svc.ReassignReviewer(req.PullRequestID, req.OldUserID, req.NewUserID, cause)
 	if err != nil {
 		switch err {
 		case models.ErrNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
 		case models.ErrPRMerged:
 			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRMERGED, "message": err.Error()}})
+		case models.ErrPRClosed:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRCLOSED, "message": err.Error()}})
 		case models.ErrNotAssigned:
 			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOTASSIGNED, "message": err.Error()}})
 		case models.ErrNoCandidate:
 			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOCANDIDATE, "message": err.Error()}})
+		case models.ErrAtCapacity:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.ATCAPACITY, "message": err.Error()}})
+		case models.ErrNotEligible:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOTELIGIBLE, "message": err.Error()}})
 		default:
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		}
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"pr": pr, "replaced_by": newReviewer})
+	c.JSON(http.StatusOK, gin.H{"pr": pr, "replaced_by": newReviewer, "reason": cause.Reason})
+}
+
+func (h *PullRequestHandler) PostPullRequestDecline(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		UserID        string `json:"user_id"`
+		Reason        string `json:"reason"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	newReviewer, pr, err := h.svc.DeclineReview(req.PullRequestID, req.UserID, req.Reason)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrPRMerged:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRMERGED, "message": err.Error()}})
+		case models.ErrPRClosed:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRCLOSED, "message": err.Error()}})
+		case models.ErrNotAssigned:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOTASSIGNED, "message": err.Error()}})
+		case models.ErrNoCandidate:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOCANDIDATE, "message": err.Error()}})
+		case models.ErrAtCapacity:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.ATCAPACITY, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr, "replaced_by": newReviewer, "reason": req.Reason})
+}
+
+func (h *PullRequestHandler) PostPullRequestReview(c *gin.Context) {
+	var req struct {
+		PullRequestID string             `json:"pull_request_id"`
+		ReviewerID    string             `json:"reviewer_id"`
+		State         models.ReviewState `json:"state"`
+		Comment       string             `json:"comment"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pr, err := h.svc.SubmitReview(req.PullRequestID, req.ReviewerID, req.State, req.Comment)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrReviewMerged:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRMERGED, "message": err.Error()}})
+		case models.ErrPRClosed:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRCLOSED, "message": err.Error()}})
+		case models.ErrNotAssigned:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.NOTASSIGNED, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr})
+}
+
+func (h *PullRequestHandler) PostPullRequestAddReviewers(c *gin.Context) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	added, pr, err := h.svc.AddReviewers(req.PullRequestID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrAddReviewersMerged:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRMERGED, "message": err.Error()}})
+		case models.ErrPRClosed:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRCLOSED, "message": err.Error()}})
+		case models.ErrPRDraft:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.PRDRAFT, "message": err.Error()}})
+		case models.ErrAtCapacity:
+			c.JSON(http.StatusConflict, gin.H{"error": gin.H{"code": models.ATCAPACITY, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pr": pr, "added": added})
+}
+
+func (h *PullRequestHandler) GetPullRequestHistory(c *gin.Context) {
+	prID := c.Query("pull_request_id")
+	if prID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pull_request_id is required"})
+		return
+	}
+
+	events, err := h.svc.History(prID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pull_request_id": prID, "events": events})
+}
+
+func (h *PullRequestHandler) GetPullRequestAssignmentTrace(c *gin.Context) {
+	prID := c.Query("pull_request_id")
+	if prID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pull_request_id is required"})
+		return
+	}
+
+	trace, err := h.svc.AssignmentTrace(prID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pull_request_id": prID, "decisions": trace})
 }
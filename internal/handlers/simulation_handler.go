@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SimulationHandler struct {
+	svc *services.SimulationService
+}
+
+func NewSimulationHandler(s *services.SimulationService) *SimulationHandler {
+	return &SimulationHandler{svc: s}
+}
+
+func (h *SimulationHandler) PostSimulateAssignments(c *gin.Context) {
+	var req struct {
+		TeamName     string                  `json:"team_name"`
+		Policy       models.SimulationPolicy `json:"policy"`
+		PullRequests []models.SimulatedPR    `json:"pull_requests"`
+		Historical   *struct {
+			From *time.Time `json:"from"`
+			To   *time.Time `json:"to"`
+		} `json:"historical"`
+		Seed *int64 `json:"seed"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var from, to *time.Time
+	if req.Historical != nil {
+		from, to = req.Historical.From, req.Historical.To
+	}
+	res, err := h.svc.Simulate(req.TeamName, req.Policy, req.PullRequests, req.Historical != nil, from, to, req.Seed)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrUnknownStrategy, models.ErrInvalidReviewersCount, models.ErrInvalidMaxOpenReviews, models.ErrEmptySimulation:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
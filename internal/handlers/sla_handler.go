@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SLAHandler struct {
+	svc *services.SLAService
+}
+
+func NewSLAHandler(s *services.SLAService) *SLAHandler {
+	return &SLAHandler{svc: s}
+}
+
+func (h *SLAHandler) GetPullRequestOverdue(c *gin.Context) {
+	at, err := parseTimeQuery(c, "at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	teamName := c.Query("team_name")
+	now, overdue, err := h.svc.Overdue(teamName, at)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"at": now, "reviews": overdue})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"pr_reviewer_service_go/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StatsHandler struct {
+	svc *services.StatsService
+}
+
+func NewStatsHandler(s *services.StatsService) *StatsHandler {
+	return &StatsHandler{svc: s}
+}
+
+func (h *StatsHandler) GetStatsAssignments(c *gin.Context) {
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := h.svc.Assignments(c.Query("team_name"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -9,11 +9,12 @@ import (
 )
 
 type TeamHandler struct {
-	svc *services.TeamService
+	svc   *services.TeamService
+	prSvc *services.PullRequestService
 }
 
-func NewTeamHandler(s *services.TeamService) *TeamHandler {
-	return &TeamHandler{svc: s}
+func NewTeamHandler(s *services.TeamService, prSvc *services.PullRequestService) *TeamHandler {
+	return &TeamHandler{svc: s, prSvc: prSvc}
 }
 
 func (h *TeamHandler) PostTeamAdd(c *gin.Context) {
@@ -22,16 +23,21 @@ func (h *TeamHandler) PostTeamAdd(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	createdTeam, err := h.svc.Create(&team)
+	createdTeam, changes, err := h.svc.Create(&team)
 	if err != nil {
-		if err == models.ErrTeamExists {
+		switch err {
+		case models.ErrTeamExists:
 			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"code": models.TEAMEXISTS, "message": err.Error()}})
-			return
+		case models.ErrUnknownStrategy, models.ErrDuplicateMember, models.ErrInvalidReviewersCount, models.ErrInvalidFallbackTeams, models.ErrInvalidOwnershipRule, models.ErrInvalidMaxOpenReviews, models.ErrInvalidReviewRules, models.ErrInvalidLargePRLines, models.ErrInvalidReviewSLA, models.ErrInvalidMergePolicy:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"team": createdTeam})
+	c.JSON(http.StatusCreated, gin.H{"team": createdTeam, "created_users": changes.Created, "updated_users": changes.Updated})
 }
 
 func (h *TeamHandler) GetTeamGet(c *gin.Context) {
@@ -49,3 +55,320 @@ func (h *TeamHandler) GetTeamGet(c *gin.Context) {
 
 	c.JSON(http.StatusOK, team)
 }
+
+func (h *TeamHandler) PostTeamSetReviewerStrategy(c *gin.Context) {
+	var req struct {
+		TeamName         string                  `json:"team_name"`
+		ReviewerStrategy models.ReviewerStrategy `json:"reviewer_strategy"`
+		ReviewerWeights  map[string]int          `json:"reviewer_weights"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetReviewerStrategy(req.TeamName, req.ReviewerStrategy, req.ReviewerWeights)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrUnknownStrategy:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamDeactivateUsers(c *gin.Context) {
+	var req struct {
+		TeamName string   `json:"team_name"`
+		UserIDs  []string `json:"user_ids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.UserIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids is required"})
+		return
+	}
+	report, err := h.prSvc.DeactivateTeamUsers(req.TeamName, req.UserIDs)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *TeamHandler) PostTeamAddMember(c *gin.Context) {
+	var req struct {
+		TeamName string `json:"team_name"`
+		models.TeamMember
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UserId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	team, replacements, err := h.svc.AddMember(req.TeamName, req.TeamMember)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team, "pull_requests": replacements})
+}
+
+func (h *TeamHandler) PostTeamRemoveMember(c *gin.Context) {
+	var req struct {
+		TeamName string `json:"team_name"`
+		UserID   string `json:"user_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, replacements, err := h.svc.RemoveMember(req.TeamName, req.UserID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team, "pull_requests": replacements})
+}
+
+func (h *TeamHandler) PostTeamRename(c *gin.Context) {
+	var req struct {
+		TeamName    string `json:"team_name"`
+		NewTeamName string `json:"new_team_name"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.NewTeamName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new_team_name is required"})
+		return
+	}
+	team, err := h.svc.Rename(req.TeamName, req.NewTeamName)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrTeamExists:
+			c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"code": models.TEAMEXISTS, "message": err.Error()}})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetMergePolicy(c *gin.Context) {
+	var req struct {
+		TeamName    string              `json:"team_name"`
+		MergePolicy *models.MergePolicy `json:"merge_policy"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetMergePolicy(req.TeamName, req.MergePolicy)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidMergePolicy:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetReviewersCount(c *gin.Context) {
+	var req struct {
+		TeamName       string `json:"team_name"`
+		ReviewersCount int    `json:"reviewers_count"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetReviewersCount(req.TeamName, req.ReviewersCount)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidReviewersCount:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetFallbackTeams(c *gin.Context) {
+	var req struct {
+		TeamName      string   `json:"team_name"`
+		FallbackTeams []string `json:"fallback_teams"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetFallbackTeams(req.TeamName, req.FallbackTeams)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidFallbackTeams:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetOwnershipRules(c *gin.Context) {
+	var req struct {
+		TeamName       string                 `json:"team_name"`
+		OwnershipRules []models.OwnershipRule `json:"ownership_rules"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetOwnershipRules(req.TeamName, req.OwnershipRules)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidOwnershipRule:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetMaxOpenReviews(c *gin.Context) {
+	var req struct {
+		TeamName       string `json:"team_name"`
+		MaxOpenReviews int    `json:"max_open_reviews"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetMaxOpenReviews(req.TeamName, req.MaxOpenReviews)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidMaxOpenReviews:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetLargePRLines(c *gin.Context) {
+	var req struct {
+		TeamName     string `json:"team_name"`
+		LargePRLines int    `json:"large_pr_lines"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetLargePRLines(req.TeamName, req.LargePRLines)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidLargePRLines:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetReviewSLA(c *gin.Context) {
+	var req struct {
+		TeamName            string `json:"team_name"`
+		ReviewSLAHours      int    `json:"review_sla_hours"`
+		AutoReassignOverdue bool   `json:"auto_reassign_overdue"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetReviewSLA(req.TeamName, req.ReviewSLAHours, req.AutoReassignOverdue)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidReviewSLA:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func (h *TeamHandler) PostTeamSetReviewRules(c *gin.Context) {
+	var req struct {
+		TeamName    string              `json:"team_name"`
+		ReviewRules *models.ReviewRules `json:"review_rules"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.svc.SetReviewRules(req.TeamName, req.ReviewRules)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidReviewRules:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
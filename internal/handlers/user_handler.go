@@ -5,6 +5,7 @@ import (
 	"pr_reviewer_service_go/internal/models"
 	"pr_reviewer_service_go/internal/repository"
 	"pr_reviewer_service_go/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,7 +29,17 @@ func (h *UserHandler) GetUsersGetReview(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
 		return
 	}
-	prs, err := h.svc.GetUserReviewPRs(userId)
+	filter := models.ReviewFilter{
+		Repository:   c.Query("repository"),
+		TargetBranch: c.Query("target_branch"),
+		Label:        c.Query("label"),
+		Priority:     models.PullRequestPriority(c.Query("priority")),
+	}
+	if filter.Priority != "" && !filter.Priority.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be low, normal or high"})
+		return
+	}
+	prs, err := h.svc.GetUserReviewPRs(userId, filter)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -47,9 +58,62 @@ func (h *UserHandler) PostUsersSetIsActive(c *gin.Context) {
 	}
 	user, err := h.svc.SetUserActive(req.UserID, req.IsActive)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		if err == models.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
+
+func (h *UserHandler) PostUsersSetAbsence(c *gin.Context) {
+	var req struct {
+		UserID string    `json:"user_id"`
+		Start  time.Time `json:"start"`
+		End    time.Time `json:"end"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	absence, replacements, err := h.svc.SetAbsence(req.UserID, req.Start, req.End)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidAbsence:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"absence": absence, "pull_requests": replacements})
+}
+
+func (h *UserHandler) PostUsersSetMaxOpenReviews(c *gin.Context) {
+	var req struct {
+		UserID         string `json:"user_id"`
+		MaxOpenReviews *int   `json:"max_open_reviews"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.svc.SetMaxOpenReviews(req.UserID, req.MaxOpenReviews)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"code": models.NOTFOUND, "message": err.Error()}})
+		case models.ErrInvalidMaxOpenReviews:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
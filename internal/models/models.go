@@ -2,6 +2,10 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -14,6 +18,13 @@ const (
 	PREXISTS    ErrorResponseErrorCode = "PR_EXISTS"
 	PRMERGED    ErrorResponseErrorCode = "PR_MERGED"
 	TEAMEXISTS  ErrorResponseErrorCode = "TEAM_EXISTS"
+
+	MERGEBLOCKED      ErrorResponseErrorCode = "MERGE_BLOCKED"
+	ATCAPACITY        ErrorResponseErrorCode = "AT_CAPACITY"
+	PRCLOSED          ErrorResponseErrorCode = "PR_CLOSED"
+	INVALIDTRANSITION ErrorResponseErrorCode = "INVALID_TRANSITION"
+	PRDRAFT           ErrorResponseErrorCode = "PR_DRAFT"
+	NOTELIGIBLE       ErrorResponseErrorCode = "NOT_ELIGIBLE"
 )
 
 var (
@@ -23,16 +34,168 @@ var (
 	ErrNotAssigned = errors.New("reviewer is not assigned to this PR")
 	ErrNoCandidate = errors.New("no active replacement candidate in team")
 	ErrNotFound    = errors.New("resource not found")
+
+	ErrUnknownStrategy = errors.New("unknown reviewer strategy")
+	ErrDuplicateMember = errors.New("duplicate user_id in members")
+	ErrInvalidReview   = errors.New("unknown review state")
+	ErrReviewMerged    = errors.New("cannot review merged PR")
+
+	ErrAddReviewersMerged    = errors.New("cannot add reviewers to merged PR")
+	ErrInvalidReviewersCount = errors.New("reviewers_count must be positive and not exceed the number of teammates")
+	ErrInvalidFallbackTeams  = errors.New("fallback_teams must list other teams without duplicates")
+	ErrInvalidOwnershipRule  = errors.New("ownership rule needs a valid pattern and at least one owner")
+	ErrInvalidAbsence        = errors.New("absence must end after it starts and not in the past")
+	ErrAtCapacity            = errors.New("every candidate is at max open reviews")
+	ErrInvalidMaxOpenReviews = errors.New("max_open_reviews must not be negative")
+	ErrInvalidReviewRules    = errors.New("review rules need distinct reviewer and author and a non-negative pairing limit")
+	ErrEmptySimulation       = errors.New("simulation needs pull_requests or a historical range")
+	ErrPRClosed              = errors.New("PR is closed")
+	ErrInvalidTransition     = errors.New("PR status does not allow this transition")
+	ErrPRDraft               = errors.New("PR is a draft")
+	ErrInvalidMetadata       = errors.New("priority must be low, normal or high, line counts must not be negative and labels must be distinct and non-empty")
+	ErrUpdateMerged          = errors.New("cannot update merged PR")
+	ErrInvalidLargePRLines   = errors.New("large_pr_lines must not be negative")
+	ErrInvalidReviewSLA      = errors.New("review_sla_hours must not be negative")
+	ErrInvalidMergePolicy    = errors.New("merge policy needs non-negative min_approvals and distinct existing users in required_group")
+	ErrNotEligible           = errors.New("new reviewer must be an available member of the reviewer's, the author's or a fallback team, not the author and not already assigned or excluded")
 )
 
+// MergeBlockedError lists the team merge policy conditions a PR does not meet.
+type MergeBlockedError struct {
+	Unmet []string
+}
+
+func (e *MergeBlockedError) Error() string {
+	return "merge blocked by team policy"
+}
+
 type PullRequest struct {
 	PullRequestID     string            `json:"pull_request_id" gorm:"primaryKey;type:varchar(100)"`
 	PullRequestName   string            `json:"pull_request_name" gorm:"not null"`
 	AuthorID          string            `json:"author_id" gorm:"index;not null"`
-	Status            PullRequestStatus `json:"status" gorm:"type:varchar(20);not null"` // OPEN | MERGED
-	AssignedReviewers []string          `json:"assigned_reviewers" gorm:"type:jsonb;serializer:json"`
+	Status            PullRequestStatus `json:"status" gorm:"type:varchar(20);not null;index"`                        // OPEN | MERGED | CLOSED
+	AssignedReviewers []string          `json:"assigned_reviewers" gorm:"type:jsonb;serializer:json;index:,type:gin"` // GIN serves @> and ?| lookups by reviewer
+	ReviewersCount    int               `json:"reviewers_count" gorm:"not null;default:2"`                            // required number of reviewers
+	NeedMoreReviewers bool              `json:"need_more_reviewers" gorm:"not null;default:false"`
+	Draft             bool              `json:"draft" gorm:"not null;default:false"`                            // reviewers are assigned on /pullRequest/markReady
+	FallbackReviewers []string          `json:"fallback_reviewers,omitempty" gorm:"type:jsonb;serializer:json"` // assigned reviewers from fallback teams
+	ChangedFiles      []string          `json:"changed_files,omitempty" gorm:"type:jsonb;serializer:json"`
+	Reviews           []Review          `json:"reviews" gorm:"type:jsonb;serializer:json"`
 	CreatedAt         time.Time         `json:"createdAt"`
 	MergedAt          *time.Time        `json:"mergedAt,omitempty"`
+	ClosedAt          *time.Time        `json:"closedAt,omitempty"`
+	// ReviewerAssignedAt and OverdueReviewers track the team review SLA
+	ReviewerAssignedAt map[string]time.Time `json:"reviewer_assigned_at,omitempty" gorm:"type:jsonb;serializer:json"`
+	OverdueReviewers   []string             `json:"overdue_reviewers,omitempty" gorm:"type:jsonb;serializer:json"`
+	// DeclinedReviewers are never picked for the PR again
+	DeclinedReviewers []string `json:"declined_reviewers,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	PullRequestMetadata `gorm:"embedded"`
+}
+
+// StampAssigned records that the reviewers were assigned at the given time.
+func (pr *PullRequest) StampAssigned(at time.Time, ids ...string) {
+	if pr.ReviewerAssignedAt == nil {
+		pr.ReviewerAssignedAt = make(map[string]time.Time, len(ids))
+	}
+	for _, id := range ids {
+		pr.ReviewerAssignedAt[id] = at
+	}
+}
+
+// ForgetReviewer drops the SLA state of a reviewer that left the PR.
+func (pr *PullRequest) ForgetReviewer(id string) {
+	delete(pr.ReviewerAssignedAt, id)
+	pr.OverdueReviewers = slices.DeleteFunc(pr.OverdueReviewers, func(o string) bool { return o == id })
+}
+
+// AssignedAt returns when the reviewer was assigned. Assignments made before
+// the time was tracked count from the PR creation.
+func (pr *PullRequest) AssignedAt(id string) time.Time {
+	if at, ok := pr.ReviewerAssignedAt[id]; ok {
+		return at
+	}
+	return pr.CreatedAt
+}
+
+// HasVerdict reports whether the user has approved or requested changes.
+func (pr *PullRequest) HasVerdict(userID string) bool {
+	for _, r := range pr.Reviews {
+		if r.ReviewerID == userID && r.State != ReviewStateCommented {
+			return true
+		}
+	}
+	return false
+}
+
+// LatestVerdicts returns the last APPROVED or CHANGES_REQUESTED state of every
+// reviewer who submitted one.
+func (pr *PullRequest) LatestVerdicts() map[string]ReviewState {
+	verdicts := map[string]ReviewState{}
+	for _, r := range pr.Reviews {
+		if r.State != ReviewStateCommented {
+			verdicts[r.ReviewerID] = r.State
+		}
+	}
+	return verdicts
+}
+
+// AssignmentDecision records one reviewer assignment of a PR: the seed of its
+// random source and every selection made with it, in order. Rerunning the
+// steps with a source seeded by Seed reproduces Picked; round_robin steps
+// carry the team cursor they started from. Decisions are kept in their own
+// append-only table and served by /pullRequest/assignmentTrace.
+type AssignmentDecision struct {
+	ID            uint            `json:"-" gorm:"primaryKey"`
+	PullRequestID string          `json:"-" gorm:"type:varchar(100);index;not null"`
+	Action        string          `json:"action" gorm:"type:varchar(20);not null"` // create | reassign | top_up | replace | ready
+	Seed          int64           `json:"seed" gorm:"not null"`
+	At            time.Time       `json:"at" gorm:"not null"`
+	Steps         []SelectionStep `json:"steps" gorm:"type:jsonb;serializer:json"`
+}
+
+const (
+	AssignmentActionCreate   = "create"
+	AssignmentActionReassign = "reassign"
+	AssignmentActionTopUp    = "top_up"
+	AssignmentActionReplace  = "replace"
+	AssignmentActionReady    = "ready"
+)
+
+type SelectionStep struct {
+	Team       string           `json:"team"`
+	Pool       string           `json:"pool"` // owners | team | fallback, with /avoided for repeated pairings
+	Strategy   ReviewerStrategy `json:"strategy"`
+	Candidates []string         `json:"candidates"` // sorted, as passed to the selector
+	AtCapacity []string         `json:"at_capacity,omitempty"`
+	Load       map[string]int   `json:"load,omitempty"`
+	Weights    map[string]int   `json:"weights,omitempty"` // weighted strategy only, as used by the selector
+	Cursor     string           `json:"cursor,omitempty"`  // round_robin strategy only, the team cursor before the step
+	Requested  int              `json:"requested"`
+	Picked     []string         `json:"picked"`
+}
+
+type Review struct {
+	ReviewerID  string      `json:"reviewer_id"`
+	State       ReviewState `json:"state"`
+	Comment     string      `json:"comment,omitempty"`
+	SubmittedAt time.Time   `json:"submitted_at"`
+}
+
+type ReviewState string
+
+const (
+	ReviewStateApproved         ReviewState = "APPROVED"
+	ReviewStateChangesRequested ReviewState = "CHANGES_REQUESTED"
+	ReviewStateCommented        ReviewState = "COMMENTED"
+)
+
+func (s ReviewState) Valid() bool {
+	switch s {
+	case ReviewStateApproved, ReviewStateChangesRequested, ReviewStateCommented:
+		return true
+	}
+	return false
 }
 
 type PullRequestStatus string
@@ -40,18 +203,347 @@ type PullRequestStatus string
 const (
 	PullRequestStatusMERGED PullRequestStatus = "MERGED"
 	PullRequestStatusOPEN   PullRequestStatus = "OPEN"
+	PullRequestStatusCLOSED PullRequestStatus = "CLOSED"
 )
 
+// pullRequestTransitions lists the allowed status changes; MERGED is final.
+var pullRequestTransitions = map[PullRequestStatus][]PullRequestStatus{
+	PullRequestStatusOPEN:   {PullRequestStatusMERGED, PullRequestStatusCLOSED},
+	PullRequestStatusCLOSED: {PullRequestStatusOPEN},
+}
+
+// CanTransition reports whether a PR in status s may move to status to.
+func (s PullRequestStatus) CanTransition(to PullRequestStatus) bool {
+	for _, next := range pullRequestTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type PullRequestShort struct {
 	AuthorId        string            `json:"author_id"`
 	PullRequestId   string            `json:"pull_request_id"`
 	PullRequestName string            `json:"pull_request_name"`
 	Status          PullRequestStatus `json:"status"`
+	PullRequestMetadata
+}
+
+type PullRequestPriority string
+
+const (
+	PullRequestPriorityLow    PullRequestPriority = "low"
+	PullRequestPriorityNormal PullRequestPriority = "normal"
+	PullRequestPriorityHigh   PullRequestPriority = "high"
+)
+
+func (p PullRequestPriority) Valid() bool {
+	switch p {
+	case PullRequestPriorityLow, PullRequestPriorityNormal, PullRequestPriorityHigh:
+		return true
+	}
+	return false
+}
+
+// PullRequestMetadata describes where a PR goes and how big it is.
+type PullRequestMetadata struct {
+	Repository   string              `json:"repository,omitempty" gorm:"type:varchar(200);index"`
+	TargetBranch string              `json:"target_branch,omitempty" gorm:"type:varchar(200)"`
+	Labels       []string            `json:"labels,omitempty" gorm:"type:jsonb;serializer:json"`
+	Priority     PullRequestPriority `json:"priority" gorm:"type:varchar(10);not null;default:'normal'"`
+	Additions    int                 `json:"additions" gorm:"not null;default:0"`
+	Deletions    int                 `json:"deletions" gorm:"not null;default:0"`
+}
+
+// Size is the number of changed lines.
+func (m PullRequestMetadata) Size() int {
+	return m.Additions + m.Deletions
+}
+
+func (m PullRequestMetadata) Valid() bool {
+	if !m.Priority.Valid() || m.Additions < 0 || m.Deletions < 0 {
+		return false
+	}
+	seen := make(map[string]struct{}, len(m.Labels))
+	for _, l := range m.Labels {
+		if l == "" {
+			return false
+		}
+		if _, ok := seen[l]; ok {
+			return false
+		}
+		seen[l] = struct{}{}
+	}
+	return true
+}
+
+// PullRequestUpdate holds the fields /pullRequest/update changes; nil fields
+// are left as they are.
+type PullRequestUpdate struct {
+	PullRequestName *string              `json:"pull_request_name"`
+	Repository      *string              `json:"repository"`
+	TargetBranch    *string              `json:"target_branch"`
+	Labels          *[]string            `json:"labels"`
+	Priority        *PullRequestPriority `json:"priority"`
+	Additions       *int                 `json:"additions"`
+	Deletions       *int                 `json:"deletions"`
+}
+
+// Apply copies the set fields onto the PR.
+func (u PullRequestUpdate) Apply(pr *PullRequest) {
+	if u.PullRequestName != nil {
+		pr.PullRequestName = *u.PullRequestName
+	}
+	if u.Repository != nil {
+		pr.Repository = *u.Repository
+	}
+	if u.TargetBranch != nil {
+		pr.TargetBranch = *u.TargetBranch
+	}
+	if u.Labels != nil {
+		pr.Labels = *u.Labels
+	}
+	if u.Priority != nil {
+		pr.Priority = *u.Priority
+	}
+	if u.Additions != nil {
+		pr.Additions = *u.Additions
+	}
+	if u.Deletions != nil {
+		pr.Deletions = *u.Deletions
+	}
+}
+
+// OverdueReview is a reviewer that has not given a verdict within the team
+// review SLA.
+type OverdueReview struct {
+	PullRequestID   string    `json:"pull_request_id"`
+	PullRequestName string    `json:"pull_request_name"`
+	AuthorID        string    `json:"author_id"`
+	TeamName        string    `json:"team_name"`
+	ReviewerID      string    `json:"reviewer_id"`
+	AssignedAt      time.Time `json:"assigned_at"`
+	DueAt           time.Time `json:"due_at"`
+}
+
+// ReviewFilter narrows /users/getReview; empty fields match everything.
+type ReviewFilter struct {
+	Repository   string
+	TargetBranch string
+	Label        string
+	Priority     PullRequestPriority
 }
 
 type Team struct {
-	TeamName string       `json:"team_name" gorm:"primaryKey;type:varchar(100)"`
-	Members  []TeamMember `json:"members" gorm:"type:jsonb;serializer:json"`
+	TeamName            string           `json:"team_name" gorm:"primaryKey;type:varchar(100)"`
+	Members             []TeamMember     `json:"members" gorm:"-"` // derived from users.team_name
+	ReviewerStrategy    ReviewerStrategy `json:"reviewer_strategy" gorm:"type:varchar(20);not null;default:'random'"`
+	ReviewerWeights     map[string]int   `json:"reviewer_weights,omitempty" gorm:"type:jsonb;serializer:json"`
+	MergePolicy         *MergePolicy     `json:"merge_policy,omitempty" gorm:"type:jsonb;serializer:json"`
+	ReviewersCount      int              `json:"reviewers_count" gorm:"not null;default:2"`
+	FallbackTeams       []string         `json:"fallback_teams,omitempty" gorm:"type:jsonb;serializer:json"` // tried in order when the team has no candidates
+	OwnershipRules      []OwnershipRule  `json:"ownership_rules,omitempty" gorm:"type:jsonb;serializer:json"`
+	MaxOpenReviews      int              `json:"max_open_reviews" gorm:"not null;default:0"` // per member, 0 is unlimited
+	ReviewRules         *ReviewRules     `json:"review_rules,omitempty" gorm:"type:jsonb;serializer:json"`
+	LargePRLines        int              `json:"large_pr_lines" gorm:"not null;default:0"`   // PRs with this many changed lines get an extra reviewer, 0 disables
+	ReviewSLAHours      int              `json:"review_sla_hours" gorm:"not null;default:0"` // time a reviewer has for a verdict, 0 disables
+	AutoReassignOverdue bool             `json:"auto_reassign_overdue" gorm:"not null;default:false"`
+	RoundRobinCursor    string           `json:"-" gorm:"type:varchar(100);not null;default:''"` // last reviewer picked by round_robin
+}
+
+// ReviewRules restrict who reviews PRs of the team authors. Exclusions are
+// never broken; reviewers over MaxConsecutivePairings are only picked when
+// nobody else is left.
+type ReviewRules struct {
+	Exclusions []ReviewExclusion `json:"exclusions,omitempty"`
+	// MaxConsecutivePairings limits how many latest PRs of one author in a row
+	// the same reviewer gets; 0 disables the limit.
+	MaxConsecutivePairings int `json:"max_consecutive_pairings,omitempty"`
+}
+
+// ReviewExclusion forbids ReviewerID to review PRs of AuthorID.
+type ReviewExclusion struct {
+	ReviewerID string `json:"reviewer_id"`
+	AuthorID   string `json:"author_id"`
+}
+
+func (r *ReviewRules) Valid() bool {
+	if r.MaxConsecutivePairings < 0 {
+		return false
+	}
+	for _, e := range r.Exclusions {
+		if e.ReviewerID == "" || e.AuthorID == "" || e.ReviewerID == e.AuthorID {
+			return false
+		}
+	}
+	return true
+}
+
+// ExcludedReviewers returns users that must not review PRs of authorID.
+func (r *ReviewRules) ExcludedReviewers(authorID string) []string {
+	if r == nil {
+		return nil
+	}
+	var ids []string
+	for _, e := range r.Exclusions {
+		if e.AuthorID == authorID {
+			ids = append(ids, e.ReviewerID)
+		}
+	}
+	return ids
+}
+
+// OwnershipRule maps a CODEOWNERS-style glob to the users and teams owning the
+// matching paths. As in CODEOWNERS, the last matching rule of a team wins.
+//
+// A pattern without a slash (or with a trailing one only) matches at any depth,
+// a leading slash anchors it to the repository root, a trailing slash matches
+// everything below the directory. "*" and "?" do not cross "/", "**" does.
+type OwnershipRule struct {
+	Pattern string   `json:"pattern"`
+	Users   []string `json:"users,omitempty"`
+	Teams   []string `json:"teams,omitempty"`
+}
+
+func (r OwnershipRule) Match(file string) bool {
+	re, err := r.regexp()
+	if err != nil {
+		return false
+	}
+	return re.MatchString(strings.TrimPrefix(file, "/"))
+}
+
+func (r OwnershipRule) Valid() bool {
+	if len(r.Users) == 0 && len(r.Teams) == 0 {
+		return false
+	}
+	_, err := r.regexp()
+	return err == nil
+}
+
+func (r OwnershipRule) regexp() (*regexp.Regexp, error) {
+	pattern := r.Pattern
+	if strings.Trim(pattern, "/") == "" {
+		return nil, ErrInvalidOwnershipRule
+	}
+
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				b.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// a directory pattern also owns everything below it
+	b.WriteString("(?:/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+const DefaultReviewersCount = 2
+
+// MergePolicy is checked by /pullRequest/merge against the verdicts of the
+// currently assigned reviewers.
+type MergePolicy struct {
+	MinApprovals            int      `json:"min_approvals"`
+	BlockOnChangesRequested bool     `json:"block_on_changes_requested"`
+	RequiredGroup           []string `json:"required_group,omitempty"` // at least one of them must approve
+}
+
+// Valid checks the policy itself; required_group users must also exist.
+func (p *MergePolicy) Valid() bool {
+	if p.MinApprovals < 0 {
+		return false
+	}
+	seen := make(map[string]struct{}, len(p.RequiredGroup))
+	for _, id := range p.RequiredGroup {
+		if _, ok := seen[id]; ok || id == "" {
+			return false
+		}
+		seen[id] = struct{}{}
+	}
+	return true
+}
+
+func (p *MergePolicy) UnmetConditions(pr *PullRequest) []string {
+	verdicts := pr.LatestVerdicts()
+
+	approvals := 0
+	var changesRequested []string
+	for _, reviewer := range pr.AssignedReviewers {
+		switch verdicts[reviewer] {
+		case ReviewStateApproved:
+			approvals++
+		case ReviewStateChangesRequested:
+			changesRequested = append(changesRequested, reviewer)
+		}
+	}
+
+	var unmet []string
+	if approvals < p.MinApprovals {
+		unmet = append(unmet, fmt.Sprintf("approvals: %d of %d", approvals, p.MinApprovals))
+	}
+	if p.BlockOnChangesRequested && len(changesRequested) > 0 {
+		unmet = append(unmet, "changes requested by "+strings.Join(changesRequested, ", "))
+	}
+	if len(p.RequiredGroup) > 0 {
+		approved := false
+		for _, u := range p.RequiredGroup {
+			if verdicts[u] == ReviewStateApproved && slices.Contains(pr.AssignedReviewers, u) {
+				approved = true
+				break
+			}
+		}
+		if !approved {
+			unmet = append(unmet, "no approval from required group: "+strings.Join(p.RequiredGroup, ", "))
+		}
+	}
+	return unmet
+}
+
+type ReviewerStrategy string
+
+const (
+	ReviewerStrategyRandom      ReviewerStrategy = "random"
+	ReviewerStrategyRoundRobin  ReviewerStrategy = "round_robin"
+	ReviewerStrategyLeastLoaded ReviewerStrategy = "least_loaded"
+	ReviewerStrategyWeighted    ReviewerStrategy = "weighted"
+)
+
+func (s ReviewerStrategy) Valid() bool {
+	switch s {
+	case ReviewerStrategyRandom, ReviewerStrategyRoundRobin, ReviewerStrategyLeastLoaded, ReviewerStrategyWeighted:
+		return true
+	}
+	return false
+}
+
+type MemberChanges struct {
+	Created []string `json:"created_users"`
+	Updated []string `json:"updated_users"`
 }
 
 type TeamMember struct {
@@ -60,9 +552,172 @@ type TeamMember struct {
 	Username string `json:"username"`
 }
 
+type DeactivationReport struct {
+	TeamName     string                `json:"team_name"`
+	Deactivated  []string              `json:"deactivated"`
+	PullRequests []ReviewerReplacement `json:"pull_requests"`
+}
+
+type ReviewerReplacement struct {
+	PullRequestID string            `json:"pull_request_id"`
+	Replaced      map[string]string `json:"replaced"` // old user_id -> new user_id
+	NoCandidate   []string          `json:"no_candidate,omitempty"`
+}
+
+type AssignmentStats struct {
+	Users        []UserAssignmentStats `json:"users"`
+	PullRequests []PRReviewerStats     `json:"pull_requests"`
+}
+
+type UserAssignmentStats struct {
+	UserID string `json:"user_id"`
+	Total  int    `json:"total"`
+	Open   int    `json:"open"`
+	Merged int    `json:"merged"`
+}
+
+type PRReviewerStats struct {
+	PullRequestID  string            `json:"pull_request_id"`
+	Status         PullRequestStatus `json:"status"`
+	ReviewersCount int               `json:"reviewers_count"`
+	Required       int               `json:"required_reviewers"`
+}
+
+// SimulationPolicy overrides the team selection settings in a simulation;
+// unset fields keep the team values.
+type SimulationPolicy struct {
+	ReviewerStrategy ReviewerStrategy `json:"reviewer_strategy,omitempty"`
+	ReviewerWeights  map[string]int   `json:"reviewer_weights,omitempty"`
+	ReviewersCount   int              `json:"reviewers_count,omitempty"`
+	MaxOpenReviews   *int             `json:"max_open_reviews,omitempty"`
+}
+
+type SimulatedPR struct {
+	PullRequestID string   `json:"pull_request_id,omitempty"`
+	AuthorID      string   `json:"author_id"`
+	ChangedFiles  []string `json:"changed_files,omitempty"`
+	Reviewers     []string `json:"reviewers"`
+}
+
+type SimulationResult struct {
+	TeamName         string           `json:"team_name"`
+	ReviewerStrategy ReviewerStrategy `json:"reviewer_strategy"`
+	Seed             int64            `json:"seed"`
+	PullRequests     []SimulatedPR    `json:"pull_requests"`
+	Distribution     map[string]int   `json:"distribution"` // assignments per available member and per picked reviewer from other teams
+	Unfilled         int              `json:"unfilled"`     // PRs left with fewer reviewers than required
+	Min              int              `json:"min"`
+	Max              int              `json:"max"`
+	Mean             float64          `json:"mean"`
+	StdDev           float64          `json:"stddev"`
+}
+
 type User struct {
-	UserID   string `json:"user_id" gorm:"primaryKey;type:varchar(100)"`
-	Username string `json:"username" gorm:"not null"`
-	IsActive bool   `json:"is_active" gorm:"default:true"`
-	TeamName string `json:"team_name" gorm:"index"`
+	UserID         string `json:"user_id" gorm:"primaryKey;type:varchar(100)"`
+	Username       string `json:"username" gorm:"not null"`
+	IsActive       bool   `json:"is_active" gorm:"default:true"`
+	TeamName       string `json:"team_name" gorm:"index"`
+	MaxOpenReviews *int   `json:"max_open_reviews,omitempty"` // overrides the team default, 0 is unlimited
+}
+
+// Capacity returns the max number of OPEN reviews of the user as a member of
+// team, 0 meaning unlimited.
+func (u User) Capacity(team *Team) int {
+	if u.MaxOpenReviews != nil {
+		return *u.MaxOpenReviews
+	}
+	return team.MaxOpenReviews
+}
+
+// Absence is a [start, end) window in which the user is not assigned to
+// reviews. When it begins, the user's OPEN reviews are handed over.
+type Absence struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       string     `json:"user_id" gorm:"index;not null"`
+	StartsAt     time.Time  `json:"start" gorm:"not null;index"`
+	EndsAt       time.Time  `json:"end" gorm:"not null"`
+	ReassignedAt *time.Time `json:"reassigned_at,omitempty"`
+}
+
+// AssignmentEvent is one entry of the append-only reviewer history of a PR.
+type AssignmentEvent struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	PullRequestID string    `json:"pull_request_id" gorm:"type:varchar(100);index;not null"`
+	Type          string    `json:"type" gorm:"type:varchar(20);not null"` // assigned | replaced | removed
+	ReviewerID    string    `json:"reviewer_id" gorm:"not null"`
+	ReplacedBy    string    `json:"replaced_by,omitempty"`
+	Actor         string    `json:"actor" gorm:"not null"`
+	Reason        string    `json:"reason,omitempty"`
+	At            time.Time `json:"at" gorm:"not null"`
+}
+
+const (
+	AssignmentEventAssigned = "assigned"
+	AssignmentEventReplaced = "replaced"
+	AssignmentEventRemoved  = "removed"
+)
+
+// AssignmentCause says who changed the reviewers of a PR and why.
+type AssignmentCause struct {
+	Actor  string
+	Reason string
+}
+
+// Actors of reviewer changes. Requests carry no identity, so every endpoint
+// acts as ActorAPI except /pullRequest/decline, where the declining reviewer
+// is the actor.
+const (
+	ActorAPI            = "api"
+	ActorAbsenceWatcher = "absence_watcher"
+	ActorSLAWatcher     = "sla_watcher"
+)
+
+const (
+	ReasonCreated     = "pr_created"
+	ReasonReady       = "marked_ready"
+	ReasonTopUp       = "top_up"
+	ReasonLargePR     = "large_pr"
+	ReasonReassigned  = "reassigned"
+	ReasonDeactivated = "deactivated"
+	ReasonLeftTeam    = "left_team"
+	ReasonAbsent      = "absent"
+	ReasonUnavailable = "unavailable"
+	ReasonOverdue     = "review_sla_overdue"
+)
+
+// Assigned returns the events of the reviewers joining the PR.
+func (c AssignmentCause) Assigned(prID string, at time.Time, ids ...string) []AssignmentEvent {
+	events := make([]AssignmentEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, c.event(AssignmentEventAssigned, prID, id, at))
+	}
+	return events
+}
+
+// Replaced returns the events of oldID handing the PR over to newID.
+func (c AssignmentCause) Replaced(prID string, at time.Time, oldID, newID string) []AssignmentEvent {
+	e := c.event(AssignmentEventReplaced, prID, oldID, at)
+	e.ReplacedBy = newID
+	return []AssignmentEvent{e, c.event(AssignmentEventAssigned, prID, newID, at)}
+}
+
+// Removed returns the events of the reviewers leaving the PR without a
+// replacement.
+func (c AssignmentCause) Removed(prID string, at time.Time, ids ...string) []AssignmentEvent {
+	events := make([]AssignmentEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, c.event(AssignmentEventRemoved, prID, id, at))
+	}
+	return events
+}
+
+func (c AssignmentCause) event(typ, prID, reviewerID string, at time.Time) AssignmentEvent {
+	return AssignmentEvent{
+		PullRequestID: prID,
+		Type:          typ,
+		ReviewerID:    reviewerID,
+		Actor:         c.Actor,
+		Reason:        c.Reason,
+		At:            at,
+	}
 }
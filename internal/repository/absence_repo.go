@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"pr_reviewer_service_go/internal/db"
+	"pr_reviewer_service_go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AbsenceRepository struct{}
+
+func NewAbsenceRepository() *AbsenceRepository { return &AbsenceRepository{} }
+
+func (r *AbsenceRepository) Create(a *models.Absence) error {
+	return db.DB.Create(a).Error
+}
+
+// ClaimStarted locks absences covering at whose reviews were not handed over
+// yet, restricted to ids when given. Rows locked by another transaction are
+// skipped, so concurrent watchers never hand over the same absence twice.
+func (r *AbsenceRepository) ClaimStarted(tx *gorm.DB, at time.Time, ids ...uint) ([]models.Absence, error) {
+	q := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("starts_at <= ? AND ends_at > ? AND reassigned_at IS NULL", at, at)
+	if len(ids) > 0 {
+		q = q.Where("id IN ?", ids)
+	}
+	var absences []models.Absence
+	err := q.Find(&absences).Error
+	return absences, err
+}
+
+func (r *AbsenceRepository) MarkReassigned(tx *gorm.DB, ids []uint, at time.Time) error {
+	return tx.Model(&models.Absence{}).
+		Where("id IN ?", ids).
+		Update("reassigned_at", at).Error
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"pr_reviewer_service_go/internal/db"
+	"pr_reviewer_service_go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// HistoryRepository stores the reviewer history and the assignment decisions
+// of PRs. Both are only ever appended.
+type HistoryRepository struct{}
+
+// appendBatchSize keeps bulk inserts well below the postgres bind parameter
+// limit.
+const appendBatchSize = 1000
+
+func NewHistoryRepository() *HistoryRepository { return &HistoryRepository{} }
+
+// AppendTx writes the events in the transaction that changes the reviewers,
+// so that no change goes unrecorded.
+func (r *HistoryRepository) AppendTx(tx *gorm.DB, events []models.AssignmentEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&events, appendBatchSize).Error
+}
+
+// AppendDecisionsTx writes the assignment decisions in the transaction that
+// applies them.
+func (r *HistoryRepository) AppendDecisionsTx(tx *gorm.DB, decisions []models.AssignmentDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&decisions, appendBatchSize).Error
+}
+
+// GetByPR returns the history of the PR, oldest first.
+func (r *HistoryRepository) GetByPR(prID string) ([]models.AssignmentEvent, error) {
+	events := []models.AssignmentEvent{}
+	err := db.DB.
+		Where("pull_request_id = ?", prID).
+		Order("at, id").
+		Find(&events).Error
+	return events, err
+}
+
+// GetDecisionsByPR returns the assignment decisions of the PR, oldest first.
+func (r *HistoryRepository) GetDecisionsByPR(prID string) ([]models.AssignmentDecision, error) {
+	decisions := []models.AssignmentDecision{}
+	err := db.DB.
+		Where("pull_request_id = ?", prID).
+		Order("id").
+		Find(&decisions).Error
+	return decisions, err
+}
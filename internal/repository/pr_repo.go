@@ -1,17 +1,26 @@
 package repository
 
 import (
+	"encoding/json"
 	"pr_reviewer_service_go/internal/db"
 	"pr_reviewer_service_go/internal/models"
+	"slices"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// updateChunkSize keeps bulk updates well below the postgres bind parameter limit.
+const updateChunkSize = 1000
+
 type PullRequestRepository struct{}
 
 func NewPRRepository() *PullRequestRepository { return &PullRequestRepository{} }
 
-func (r *PullRequestRepository) CreatePullRequest(pr *models.PullRequest) error {
-	return db.DB.Create(pr).Error
+func (r *PullRequestRepository) CreatePullRequest(tx *gorm.DB, pr *models.PullRequest) error {
+	return tx.Create(pr).Error
 }
 
 func (r *PullRequestRepository) MergePullRequest(prID string, mergedAt *time.Time) error {
@@ -23,8 +32,81 @@ func (r *PullRequestRepository) MergePullRequest(prID string, mergedAt *time.Tim
 		}).Error
 }
 
-func (r *PullRequestRepository) Save(pr *models.PullRequest) error {
-	return db.DB.Save(pr).Error
+func (r *PullRequestRepository) ClosePullRequest(prID string, closedAt *time.Time) error {
+	return db.DB.Model(&models.PullRequest{}).
+		Where("pull_request_id = ?", prID).
+		Updates(map[string]interface{}{
+			"status":    models.PullRequestStatusCLOSED,
+			"closed_at": closedAt,
+		}).Error
+}
+
+// AddReview appends the review to the PR atomically.
+func (r *PullRequestRepository) AddReview(tx *gorm.DB, prID string, review models.Review) error {
+	raw, err := json.Marshal([]models.Review{review})
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`
+		UPDATE pull_requests SET reviews = COALESCE(reviews, '[]'::jsonb) || ?::jsonb
+		WHERE pull_request_id = ?`, string(raw), prID).Error
+}
+
+// assignmentColumns hold the reviewer assignment of a PR.
+var assignmentColumns = []string{"assigned_reviewers", "fallback_reviewers", "need_more_reviewers",
+	"reviewer_assigned_at", "overdue_reviewers", "declined_reviewers"}
+
+// UpdateAssignment stores the reviewer assignment, the reviewer SLA state and
+// the given extra columns of the PR.
+func (r *PullRequestRepository) UpdateAssignment(tx *gorm.DB, pr *models.PullRequest, columns ...string) error {
+	return r.Update(tx, pr, append(slices.Clone(assignmentColumns), columns...)...)
+}
+
+// Update stores the given columns of the PR. Reviews are never rewritten from
+// a PR read earlier, they are only appended by AddReview.
+func (r *PullRequestRepository) Update(tx *gorm.DB, pr *models.PullRequest, columns ...string) error {
+	return tx.Model(pr).
+		Select(columns).
+		Updates(pr).Error
+}
+
+// UpdateOverdue stores overdue_reviewers only.
+func (r *PullRequestRepository) UpdateOverdue(tx *gorm.DB, pr *models.PullRequest) error {
+	return tx.Model(pr).
+		Select("overdue_reviewers").
+		Updates(pr).Error
+}
+
+// GetOpenByAuthorTeam returns OPEN non-draft PRs authored by the team members.
+func (r *PullRequestRepository) GetOpenByAuthorTeam(teamName string) ([]models.PullRequest, error) {
+	var prs []models.PullRequest
+	err := db.DB.
+		Where("status = ? AND draft = ?", models.PullRequestStatusOPEN, false).
+		Where("author_id IN (?)", db.DB.Model(&models.User{}).Select("user_id").Where("team_name = ?", teamName)).
+		Order("pull_request_id").
+		Find(&prs).Error
+	return prs, err
+}
+
+func (r *PullRequestRepository) GetNeedingReviewers(teamName string) ([]models.PullRequest, error) {
+	var prs []models.PullRequest
+	err := db.DB.
+		Where("status = ? AND need_more_reviewers = ?", models.PullRequestStatusOPEN, true).
+		Where("author_id IN (?)", db.DB.Model(&models.User{}).Select("user_id").Where("team_name = ?", teamName)).
+		Find(&prs).Error
+	return prs, err
+}
+
+// GetLatestByAuthor returns up to limit latest PRs of the author other than
+// exceptID, newest first.
+func (r *PullRequestRepository) GetLatestByAuthor(authorID, exceptID string, limit int) ([]models.PullRequest, error) {
+	var prs []models.PullRequest
+	err := db.DB.
+		Where("author_id = ? AND pull_request_id <> ?", authorID, exceptID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&prs).Error
+	return prs, err
 }
 
 func (r *PullRequestRepository) GetByID(prID string) (*models.PullRequest, error) {
@@ -35,3 +117,141 @@ func (r *PullRequestRepository) GetByID(prID string) (*models.PullRequest, error
 	}
 	return &pr, nil
 }
+
+// GetByIDForUpdate reads the PR and locks its row until tx ends, so
+// read-modify-write changes of the assignment do not overwrite each other.
+func (r *PullRequestRepository) GetByIDForUpdate(tx *gorm.DB, prID string) (*models.PullRequest, error) {
+	var pr models.PullRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("pull_request_id = ?", prID).
+		First(&pr).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r *PullRequestRepository) CountOpenReviews(userIDs []string) (map[string]int, error) {
+	var rows []struct {
+		UserID string
+		Count  int
+	}
+	reviewed, err := anyReviewer(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = db.DB.Raw(`
+		SELECT reviewer AS user_id, COUNT(*) AS count
+		FROM pull_requests, jsonb_array_elements_text(assigned_reviewers) AS reviewer
+		WHERE status = ? AND ? AND reviewer IN ?
+		GROUP BY reviewer`, models.PullRequestStatusOPEN, reviewed, userIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(userIDs))
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetOpenByReviewers returns OPEN PRs reviewed by any of the users and locks
+// them until tx ends. Rows are locked in pull_request_id order so that
+// concurrent callers do not deadlock.
+func (r *PullRequestRepository) GetOpenByReviewers(tx *gorm.DB, userIDs []string) ([]models.PullRequest, error) {
+	reviewed, err := anyReviewer(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	var prs []models.PullRequest
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status = ?", models.PullRequestStatusOPEN).
+		Where(reviewed).
+		Order("pull_request_id").
+		Find(&prs).Error
+	return prs, err
+}
+
+// anyReviewer matches PRs with any of the users in assigned_reviewers using the
+// jsonb ?| operator, which the GIN index on the column serves. gorm binds every
+// "?" of a condition, so the operator goes in as a nested expression.
+func anyReviewer(userIDs []string) (clause.Expr, error) {
+	ids, err := json.Marshal(userIDs)
+	if err != nil {
+		return clause.Expr{}, err
+	}
+	return clause.Expr{
+		SQL:  "assigned_reviewers ? ARRAY(SELECT jsonb_array_elements_text(?::jsonb))",
+		Vars: []interface{}{clause.Expr{SQL: "?|"}, string(ids)},
+	}, nil
+}
+
+func (r *PullRequestRepository) UpdateReviewers(tx *gorm.DB, prs []models.PullRequest) error {
+	for start := 0; start < len(prs); start += updateChunkSize {
+		end := min(start+updateChunkSize, len(prs))
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, 6*(end-start))
+		for _, pr := range prs[start:end] {
+			revs, err := json.Marshal(pr.AssignedReviewers)
+			if err != nil {
+				return err
+			}
+			fallback, err := json.Marshal(pr.FallbackReviewers)
+			if err != nil {
+				return err
+			}
+			assignedAt, err := json.Marshal(pr.ReviewerAssignedAt)
+			if err != nil {
+				return err
+			}
+			overdue, err := json.Marshal(pr.OverdueReviewers)
+			if err != nil {
+				return err
+			}
+			values = append(values, "(?, ?::jsonb, ?::jsonb, ?::boolean, ?::jsonb, ?::jsonb)")
+			args = append(args, pr.PullRequestID, string(revs), string(fallback), pr.NeedMoreReviewers,
+				string(assignedAt), string(overdue))
+		}
+
+		err := tx.Exec(`
+			UPDATE pull_requests AS p
+			SET assigned_reviewers = v.revs, fallback_reviewers = v.fallback, need_more_reviewers = v.need,
+				reviewer_assigned_at = v.assigned_at, overdue_reviewers = v.overdue
+			FROM (VALUES `+strings.Join(values, ", ")+`) AS v(id, revs, fallback, need, assigned_at, overdue)
+			WHERE p.pull_request_id = v.id`, args...).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetForStats returns PRs authored by members of teamName (any team if empty)
+// that were created or merged within [from, to). Nil bounds are open.
+func (r *PullRequestRepository) GetForStats(teamName string, from, to *time.Time) ([]models.PullRequest, error) {
+	q := db.DB.Model(&models.PullRequest{})
+	if teamName != "" {
+		q = q.Where("author_id IN (?)", db.DB.Model(&models.User{}).Select("user_id").Where("team_name = ?", teamName))
+	}
+	if from != nil || to != nil {
+		q = q.Where(db.DB.Where(timeRange("created_at", from, to)).Or(timeRange("merged_at", from, to)))
+	}
+
+	var prs []models.PullRequest
+	err := q.Order("pull_request_id").Find(&prs).Error
+	return prs, err
+}
+
+func timeRange(column string, from, to *time.Time) *gorm.DB {
+	cond := db.DB.Where(column + " IS NOT NULL")
+	if from != nil {
+		cond = cond.Where(column+" >= ?", *from)
+	}
+	if to != nil {
+		cond = cond.Where(column+" < ?", *to)
+	}
+	return cond
+}
@@ -5,6 +5,7 @@ import (
 	"pr_reviewer_service_go/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TeamRepository struct{}
@@ -26,3 +27,88 @@ func (r *TeamRepository) GetTeamByName(teamName string) (*models.Team, error) {
 	}
 	return &team, nil
 }
+
+// GetWithReviewSLA returns the teams that have a review SLA.
+func (r *TeamRepository) GetWithReviewSLA() ([]models.Team, error) {
+	var teams []models.Team
+	err := db.DB.Where("review_sla_hours > 0").Order("team_name").Find(&teams).Error
+	return teams, err
+}
+
+// Update stores the given columns of the team.
+func (r *TeamRepository) Update(t *models.Team, columns ...string) error {
+	return db.DB.Model(t).
+		Select(columns).
+		Updates(t).Error
+}
+
+// LockRoundRobinCursor locks the team row in tx and returns its current
+// round_robin cursor, so that concurrent assignments pick in turn.
+func (r *TeamRepository) LockRoundRobinCursor(tx *gorm.DB, teamName string) (string, error) {
+	var team models.Team
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("round_robin_cursor").
+		Where("team_name = ?", teamName).
+		First(&team).Error
+	return team.RoundRobinCursor, err
+}
+
+// UpdateRoundRobinCursor stores the last reviewer picked by round_robin.
+func (r *TeamRepository) UpdateRoundRobinCursor(tx *gorm.DB, teamName, cursor string) error {
+	return tx.Model(&models.Team{}).
+		Where("team_name = ?", teamName).
+		Update("round_robin_cursor", cursor).Error
+}
+
+func (r *TeamRepository) Rename(tx *gorm.DB, oldName, newName string) error {
+	var existing models.Team
+	if err := tx.Where("team_name = ?", newName).First(&existing).Error; err == nil {
+		return models.ErrTeamExists
+	}
+
+	res := tx.Model(&models.Team{}).Where("team_name = ?", oldName).Update("team_name", newName)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// RenameFallbackTeam replaces oldName with newName in fallback_teams of every
+// team, keeping the order.
+func (r *TeamRepository) RenameFallbackTeam(tx *gorm.DB, oldName, newName string) error {
+	return tx.Exec(`
+		UPDATE teams SET fallback_teams = (
+			SELECT jsonb_agg(CASE WHEN name = ? THEN ? ELSE name END ORDER BY pos)
+			FROM jsonb_array_elements_text(fallback_teams) WITH ORDINALITY AS f(name, pos)
+		)
+		WHERE fallback_teams @> jsonb_build_array(?::text)`, oldName, newName, oldName).Error
+}
+
+// RenameOwnerTeam replaces oldName with newName in the owner teams of every
+// ownership rule.
+func (r *TeamRepository) RenameOwnerTeam(tx *gorm.DB, oldName, newName string) error {
+	var teams []models.Team
+	err := tx.
+		Where("EXISTS (SELECT 1 FROM jsonb_array_elements(ownership_rules) AS rule WHERE rule->'teams' @> jsonb_build_array(?::text))", oldName).
+		Find(&teams).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range teams {
+		for _, rule := range teams[i].OwnershipRules {
+			for j, name := range rule.Teams {
+				if name == oldName {
+					rule.Teams[j] = newName
+				}
+			}
+		}
+		if err := tx.Model(&teams[i]).Select("ownership_rules").Updates(&teams[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
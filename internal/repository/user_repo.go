@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"encoding/json"
 	"pr_reviewer_service_go/internal/db"
 	"pr_reviewer_service_go/internal/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct{}
@@ -13,8 +16,19 @@ func NewUserRepository() *UserRepository {
 	return &UserRepository{}
 }
 
-func (r *UserRepository) CreateUser(tx *gorm.DB, u *models.User) error {
-	return tx.Create(u).Error
+// UpsertUsers inserts users or overwrites username, is_active and team_name of
+// existing ones.
+func (r *UserRepository) UpsertUsers(tx *gorm.DB, users []models.User) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"username", "is_active", "team_name"}),
+	}).Select("*").Create(&users).Error
+}
+
+func (r *UserRepository) GetByIDs(tx *gorm.DB, userIDs []string) ([]models.User, error) {
+	var users []models.User
+	err := tx.Where("user_id IN ?", userIDs).Find(&users).Error
+	return users, err
 }
 
 func (r *UserRepository) SetUserActiveStatus(userID string, isActive bool) error {
@@ -23,23 +37,94 @@ func (r *UserRepository) SetUserActiveStatus(userID string, isActive bool) error
 		Update("is_active", isActive).Error
 }
 
+func (r *UserRepository) SetMaxOpenReviews(userID string, limit *int) error {
+	return db.DB.Model(&models.User{}).
+		Where("user_id = ?", userID).
+		Update("max_open_reviews", limit).Error
+}
+
+func (r *UserRepository) DeactivateUsers(tx *gorm.DB, userIDs []string) error {
+	return tx.Model(&models.User{}).
+		Where("user_id IN ?", userIDs).
+		Update("is_active", false).Error
+}
+
+func (r *UserRepository) SetTeam(tx *gorm.DB, userID, teamName string) error {
+	return tx.Model(&models.User{}).
+		Where("user_id = ?", userID).
+		Update("team_name", teamName).Error
+}
+
+func (r *UserRepository) RenameTeam(tx *gorm.DB, oldName, newName string) error {
+	return tx.Model(&models.User{}).
+		Where("team_name = ?", oldName).
+		Update("team_name", newName).Error
+}
+
 func (r *UserRepository) GetUsersByTeam(teamName string) ([]models.User, error) {
 	var users []models.User
-	err := db.DB.Where("team_name = ?", teamName).Find(&users).Error
+	err := db.DB.Where("team_name = ?", teamName).Order("user_id").Find(&users).Error
 	return users, err
 }
 
-func (r *UserRepository) GetActiveUsersByTeam(teamName string) ([]models.User, error) {
+// GetAvailableUsersByTeam returns active team members without an absence
+// covering at.
+func (r *UserRepository) GetAvailableUsersByTeam(teamName string, at time.Time) ([]models.User, error) {
 	var users []models.User
-	err := db.DB.Where("team_name = ? AND is_active = ?", teamName, true).Find(&users).Error
+	err := db.DB.Scopes(available(at)).
+		Where("team_name = ?", teamName).
+		Find(&users).Error
 	return users, err
 }
 
-func (r *UserRepository) GetUsersReviews(userID string) ([]models.PullRequest, error) {
+// GetAvailableOwners returns available users listed in userIDs or belonging to
+// one of teamNames.
+func (r *UserRepository) GetAvailableOwners(userIDs, teamNames []string, at time.Time) ([]models.User, error) {
+	var users []models.User
+	err := db.DB.Scopes(available(at)).
+		Where("user_id IN ? OR team_name IN ?", userIDs, teamNames).
+		Find(&users).Error
+	return users, err
+}
+
+// GetAvailableByIDs returns the listed users that are active and not absent
+// at the given time.
+func (r *UserRepository) GetAvailableByIDs(userIDs []string, at time.Time) ([]models.User, error) {
+	var users []models.User
+	err := db.DB.Scopes(available(at)).
+		Where("user_id IN ?", userIDs).
+		Find(&users).Error
+	return users, err
+}
+
+func available(at time.Time) func(*gorm.DB) *gorm.DB {
+	return func(q *gorm.DB) *gorm.DB {
+		return q.Where("is_active = ?", true).
+			Where("NOT EXISTS (SELECT 1 FROM absences a WHERE a.user_id = users.user_id AND a.starts_at <= ? AND a.ends_at > ?)", at, at)
+	}
+}
+
+func (r *UserRepository) GetUsersReviews(userID string, filter models.ReviewFilter) ([]models.PullRequest, error) {
 	var pullRequests []models.PullRequest
-	err := db.DB.
-		Where("assigned_reviewers @> ? AND status = ?", `["`+userID+`"]`, models.PullRequestStatusOPEN).
-		Find(&pullRequests).Error
+	q := db.DB.
+		Where("assigned_reviewers @> ? AND status = ?", `["`+userID+`"]`, models.PullRequestStatusOPEN)
+	if filter.Repository != "" {
+		q = q.Where("repository = ?", filter.Repository)
+	}
+	if filter.TargetBranch != "" {
+		q = q.Where("target_branch = ?", filter.TargetBranch)
+	}
+	if filter.Label != "" {
+		label, err := json.Marshal([]string{filter.Label})
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("labels @> ?", string(label))
+	}
+	if filter.Priority != "" {
+		q = q.Where("priority = ?", filter.Priority)
+	}
+	err := q.Find(&pullRequests).Error
 	return pullRequests, err
 }
 
@@ -1,44 +1,102 @@
 package router
 
 import (
+	"context"
+	"os"
 	"pr_reviewer_service_go/internal/handlers"
 	"pr_reviewer_service_go/internal/repository"
 	"pr_reviewer_service_go/internal/services"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func New() *gin.Engine {
+// Watcher is a background job that runs until ctx is done.
+type Watcher func(ctx context.Context)
+
+// New wires the handlers and returns the engine together with the background
+// watchers, which the caller runs and stops.
+func New() (*gin.Engine, []Watcher) {
 	r := gin.Default()
 
 	userRepo := repository.NewUserRepository()
 	teamRepo := repository.NewTeamRepository()
 	prRepo := repository.NewPRRepository()
 	trRepo := repository.NewTransactionRepository()
+	absenceRepo := repository.NewAbsenceRepository()
+	historyRepo := repository.NewHistoryRepository()
 
-	teamSvc := services.NewTeamService(teamRepo, userRepo, trRepo)
-	userSvc := services.NewUserService(userRepo)
-	prSvc := services.NewPRService(prRepo, userRepo, teamRepo)
+	prSvc := services.NewPRService(prRepo, userRepo, teamRepo, trRepo, historyRepo)
+	teamSvc := services.NewTeamService(teamRepo, userRepo, trRepo, prSvc)
+	userSvc := services.NewUserService(userRepo, absenceRepo, teamRepo, trRepo, prSvc)
+	statsSvc := services.NewStatsService(prRepo)
+	simSvc := services.NewSimulationService(prRepo, userRepo, teamRepo, prSvc)
+	// a fixed seed makes reviewer assignment reproducible across runs;
+	// simulations draw from their own sequence so they do not shift it
+	if seed, err := strconv.ParseInt(os.Getenv("ASSIGNMENT_SEED"), 10, 64); err == nil {
+		prSvc.SetSeedSource(services.SeedSequence(seed))
+		simSvc.SetSeedSource(services.SeedSequence(seed))
+	}
+	slaSvc := services.NewSLAService(prRepo, teamRepo, trRepo, prSvc)
 
-	teamH := handlers.NewTeamHandler(teamSvc)
+	teamH := handlers.NewTeamHandler(teamSvc, prSvc)
 	userH := handlers.NewUserHandler(userSvc, prRepo)
 	prH := handlers.NewPullRequestHandler(prSvc)
+	statsH := handlers.NewStatsHandler(statsSvc)
+	simH := handlers.NewSimulationHandler(simSvc)
+	slaH := handlers.NewSLAHandler(slaSvc)
 
 	api := r.Group("/")
 	{
 		// Teams
 		api.POST("/team/add", teamH.PostTeamAdd)
 		api.GET("/team/get", teamH.GetTeamGet)
+		api.POST("/team/setReviewerStrategy", teamH.PostTeamSetReviewerStrategy)
+		api.POST("/team/setMergePolicy", teamH.PostTeamSetMergePolicy)
+		api.POST("/team/setReviewersCount", teamH.PostTeamSetReviewersCount)
+		api.POST("/team/setFallbackTeams", teamH.PostTeamSetFallbackTeams)
+		api.POST("/team/setOwnershipRules", teamH.PostTeamSetOwnershipRules)
+		api.POST("/team/setMaxOpenReviews", teamH.PostTeamSetMaxOpenReviews)
+		api.POST("/team/setReviewRules", teamH.PostTeamSetReviewRules)
+		api.POST("/team/setLargePRLines", teamH.PostTeamSetLargePRLines)
+		api.POST("/team/setReviewSLA", teamH.PostTeamSetReviewSLA)
+		api.POST("/team/deactivateUsers", teamH.PostTeamDeactivateUsers)
+		api.POST("/team/addMember", teamH.PostTeamAddMember)
+		api.POST("/team/removeMember", teamH.PostTeamRemoveMember)
+		api.POST("/team/rename", teamH.PostTeamRename)
 
 		// Users
 		api.POST("/users/setIsActive", userH.PostUsersSetIsActive)
 		api.GET("/users/getReview", userH.GetUsersGetReview)
+		api.POST("/users/setAbsence", userH.PostUsersSetAbsence)
+		api.POST("/users/setMaxOpenReviews", userH.PostUsersSetMaxOpenReviews)
 
 		// PullRequests
 		api.POST("/pullRequest/create", prH.PostPullRequestCreate)
+		api.POST("/pullRequest/update", prH.PostPullRequestUpdate)
+		api.POST("/pullRequest/markReady", prH.PostPullRequestMarkReady)
 		api.POST("/pullRequest/merge", prH.PostPullRequestMerge)
+		api.POST("/pullRequest/close", prH.PostPullRequestClose)
+		api.POST("/pullRequest/reopen", prH.PostPullRequestReopen)
 		api.POST("/pullRequest/reassign", prH.PostPullRequestReassign)
+		api.POST("/pullRequest/decline", prH.PostPullRequestDecline)
+		api.POST("/pullRequest/review", prH.PostPullRequestReview)
+		api.POST("/pullRequest/addReviewers", prH.PostPullRequestAddReviewers)
+		api.GET("/pullRequest/assignmentTrace", prH.GetPullRequestAssignmentTrace)
+		api.GET("/pullRequest/history", prH.GetPullRequestHistory)
+		api.GET("/pullRequest/overdue", slaH.GetPullRequestOverdue)
+
+		// Stats
+		api.GET("/stats/assignments", statsH.GetStatsAssignments)
+
+		// Simulation
+		api.POST("/simulate/assignments", simH.PostSimulateAssignments)
 	}
 
-	return r
+	watchers := []Watcher{
+		func(ctx context.Context) { userSvc.WatchAbsences(ctx, time.Minute) },
+		func(ctx context.Context) { slaSvc.WatchOverdue(ctx, time.Minute) },
+	}
+	return r, watchers
 }
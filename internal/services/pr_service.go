@@ -1,23 +1,110 @@
 package services
 
 import (
+	"maps"
 	"math/rand"
 	"pr_reviewer_service_go/internal/models"
 	"pr_reviewer_service_go/internal/repository"
+	"slices"
+	"sort"
+	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type PullRequestService struct {
-	prRepo   *repository.PullRequestRepository
-	userRepo *repository.UserRepository
-	teamRepo *repository.TeamRepository
+	prRepo          *repository.PullRequestRepository
+	userRepo        *repository.UserRepository
+	teamRepo        *repository.TeamRepository
+	transactionRepo *repository.TransactionRepository
+	historyRepo     *repository.HistoryRepository
+
+	selectors map[models.ReviewerStrategy]ReviewerSelector
+	now       func() time.Time
+	seeds     func() int64
+}
+
+func NewPRService(pr *repository.PullRequestRepository, ur *repository.UserRepository, tr *repository.TeamRepository, transRepo *repository.TransactionRepository, hr *repository.HistoryRepository) *PullRequestService {
+	return &PullRequestService{
+		prRepo:          pr,
+		userRepo:        ur,
+		teamRepo:        tr,
+		transactionRepo: transRepo,
+		historyRepo:     hr,
+		selectors:       newSelectors(),
+		now:             func() time.Time { return time.Now().UTC() },
+		seeds:           func() int64 { return time.Now().UnixNano() },
+	}
+}
+
+// SetClock replaces the source of timestamps and of every availability,
+// absence and review SLA check.
+func (s *PullRequestService) SetClock(now func() time.Time) {
+	s.now = now
 }
 
-func NewPRService(pr *repository.PullRequestRepository, ur *repository.UserRepository, tr *repository.TeamRepository) *PullRequestService {
-	return &PullRequestService{prRepo: pr, userRepo: ur, teamRepo: tr}
+// SetSeedSource replaces the source of seeds of reviewer assignments.
+func (s *PullRequestService) SetSeedSource(seeds func() int64) {
+	s.seeds = seeds
+}
+
+// SeedSequence returns a seed source that yields the same sequence for the
+// same seed. It is safe for concurrent use.
+func SeedSequence(seed int64) func() int64 {
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func() int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Int63()
+	}
+}
+
+// assignment carries the random source of one reviewer assignment and
+// records its decision.
+type assignment struct {
+	rand     *rand.Rand
+	decision *models.AssignmentDecision
+	// tx is the transaction the assignment is stored in; round_robin
+	// cursors are read under its lock
+	tx *gorm.DB
+	// sim is set for simulated assignments, which read and change an
+	// in-memory state instead of the stored one
+	sim *simulatedState
+}
+
+// newAssignment starts an assignment of the PR, stored in tx and seeded by the
+// seed source.
+func (s *PullRequestService) newAssignment(tx *gorm.DB, prID, action string) *assignment {
+	sd := s.seeds()
+	return &assignment{
+		rand: rand.New(rand.NewSource(sd)),
+		tx:   tx,
+		decision: &models.AssignmentDecision{
+			PullRequestID: prID,
+			Action:        action,
+			Seed:          sd,
+			At:            s.now(),
+			Steps:         []models.SelectionStep{},
+		},
+	}
 }
 
-func (s *PullRequestService) Create(prID, title string, authorId string) (models.PullRequest, error) {
+// Create opens a PR and assigns reviewers from the author's team. A nil
+// reviewersCount falls back to the team default. When changedFiles match the
+// team ownership rules, the first reviewer is picked among the owners. A draft
+// PR gets no reviewers until it is marked ready. Large PRs get one reviewer
+// more than requested. A PR of an author without a team is created with no
+// reviewers and need_more_reviewers.
+func (s *PullRequestService) Create(prID, title string, authorId string, reviewersCount *int, changedFiles []string, meta models.PullRequestMetadata, draft bool) (models.PullRequest, error) {
+	if meta.Priority == "" {
+		meta.Priority = models.PullRequestPriorityNormal
+	}
+	if !meta.Valid() {
+		return models.PullRequest{}, models.ErrInvalidMetadata
+	}
+
 	author, err := s.userRepo.GetByID(authorId)
 	if err != nil {
 		return models.PullRequest{}, models.ErrNotFound
@@ -27,26 +114,150 @@ func (s *PullRequestService) Create(prID, title string, authorId string) (models
 		return models.PullRequest{}, models.ErrPRExists
 	}
 
-	revs, err := s.assignReviewers(*author)
+	team, err := s.authorTeam(author)
+	if err != nil {
+		return models.PullRequest{}, models.ErrNotFound
+	}
+
+	count, err := s.reviewersCount(team, reviewersCount)
 	if err != nil {
 		return models.PullRequest{}, err
 	}
+	if isLargePR(team, meta.Size()) {
+		if count, err = s.withExtraReviewer(team, count); err != nil {
+			return models.PullRequest{}, err
+		}
+	}
 
 	pr := models.PullRequest{
 		PullRequestID:     prID,
 		PullRequestName:   title,
 		AuthorID:          authorId,
-		AssignedReviewers: revs,
+		AssignedReviewers: []string{},
+		ReviewersCount:    count,
+		ChangedFiles:      changedFiles,
+		Reviews:           []models.Review{},
 		Status:            models.PullRequestStatusOPEN,
+		Draft:             draft,
+
+		PullRequestMetadata: meta,
 	}
+	err = s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var decisions []models.AssignmentDecision
+		if !draft {
+			a := s.newAssignment(tx, prID, models.AssignmentActionCreate)
+			if err := s.assignReviewers(a, team, &pr); err != nil {
+				return err
+			}
+			decisions = append(decisions, *a.decision)
+		}
 
-	if err := s.prRepo.CreatePullRequest(&pr); err != nil {
+		if err := s.prRepo.CreatePullRequest(tx, &pr); err != nil {
+			return err
+		}
+		if err := s.saveDecisions(tx, decisions); err != nil {
+			return err
+		}
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonCreated}
+		return s.historyRepo.AppendTx(tx, cause.Assigned(prID, s.now(), pr.AssignedReviewers...))
+	})
+	if err != nil {
 		return pr, err
 	}
 
 	return pr, nil
 }
 
+// assignReviewers picks the reviewers of a PR without any: one among the
+// owners of the changed files, the rest from the team and its fallback teams.
+// Free slots are flagged with need_more_reviewers; ErrAtCapacity is returned
+// only when nobody was picked because the candidates are full.
+func (s *PullRequestService) assignReviewers(a *assignment, team *models.Team, pr *models.PullRequest) error {
+	exclude := map[string]struct{}{pr.AuthorID: {}}
+	avoid, err := s.applyReviewRules(a, team, pr.AuthorID, pr.PullRequestID, exclude)
+	if err != nil {
+		return err
+	}
+	owners, err := s.ownerCandidates(team, pr.ChangedFiles, exclude)
+	if err != nil {
+		return err
+	}
+	revs := []string{}
+	if len(owners) > 0 {
+		revs, err = s.pickAvoiding(a, team, "owners", owners, avoid, 1)
+		if err == models.ErrAtCapacity {
+			revs, err = []string{}, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range revs {
+		exclude[id] = struct{}{}
+	}
+
+	rest, fallback, err := s.pickWithFallback(a, team, team, exclude, avoid, pr.ReviewersCount-len(revs))
+	if err == models.ErrAtCapacity && len(revs) > 0 {
+		// the owner alone is a valid partial assignment
+		rest, fallback, err = []string{}, []string{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pr.AssignedReviewers = append(revs, rest...)
+	pr.FallbackReviewers = fallback
+	pr.StampAssigned(a.decision.At, pr.AssignedReviewers...)
+	pr.NeedMoreReviewers = len(pr.AssignedReviewers) < pr.ReviewersCount
+	return nil
+}
+
+// MarkReady turns a draft PR into a regular one and assigns its reviewers the
+// way Create does. Marking a non-draft PR ready is a no-op.
+func (s *PullRequestService) MarkReady(pullRequestId string) (*models.PullRequest, error) {
+	var pr *models.PullRequest
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if !pr.Draft {
+			return nil
+		}
+		if pr.Status == models.PullRequestStatusCLOSED {
+			return models.ErrPRClosed
+		}
+
+		author, err := s.userRepo.GetByID(pr.AuthorID)
+		if err != nil {
+			return err
+		}
+		team, err := s.authorTeam(author)
+		if err != nil {
+			return err
+		}
+
+		a := s.newAssignment(tx, pr.PullRequestID, models.AssignmentActionReady)
+		if err := s.assignReviewers(a, team, pr); err != nil {
+			return err
+		}
+		pr.Draft = false
+		if err := s.prRepo.UpdateAssignment(tx, pr, "draft"); err != nil {
+			return err
+		}
+		if err := s.saveDecisions(tx, []models.AssignmentDecision{*a.decision}); err != nil {
+			return err
+		}
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonReady}
+		return s.historyRepo.AppendTx(tx, cause.Assigned(pr.PullRequestID, a.decision.At, pr.AssignedReviewers...))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
 func (s *PullRequestService) MergePullRequest(pullRequestId string) (*models.PullRequest, error) {
 	pr, err := s.prRepo.GetByID(pullRequestId)
 	if err != nil {
@@ -55,7 +266,24 @@ func (s *PullRequestService) MergePullRequest(pullRequestId string) (*models.Pul
 	if pr.Status == models.PullRequestStatusMERGED {
 		return pr, nil
 	}
-	now := time.Now().UTC()
+	if !pr.Status.CanTransition(models.PullRequestStatusMERGED) {
+		return nil, models.ErrInvalidTransition
+	}
+	if pr.Draft {
+		return nil, models.ErrPRDraft
+	}
+
+	policy, err := s.mergePolicyFor(pr)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		if unmet := policy.UnmetConditions(pr); len(unmet) > 0 {
+			return nil, &models.MergeBlockedError{Unmet: unmet}
+		}
+	}
+
+	now := s.now()
 	if err := s.prRepo.MergePullRequest(pullRequestId, &now); err != nil {
 		return nil, err
 	}
@@ -64,51 +292,719 @@ func (s *PullRequestService) MergePullRequest(pullRequestId string) (*models.Pul
 	return pr, nil
 }
 
-func (s *PullRequestService) assignReviewers(author models.User) ([]string, error) {
-	activeUsers, err := s.userRepo.GetActiveUsersByTeam(author.TeamName)
+// ClosePullRequest closes an OPEN PR without merging it. The reviewers stay
+// assigned so that a reopen can restore them; closing a CLOSED PR is a no-op.
+func (s *PullRequestService) ClosePullRequest(pullRequestId string) (*models.PullRequest, error) {
+	pr, err := s.prRepo.GetByID(pullRequestId)
 	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	if pr.Status == models.PullRequestStatusCLOSED {
+		return pr, nil
+	}
+	if !pr.Status.CanTransition(models.PullRequestStatusCLOSED) {
+		return nil, models.ErrInvalidTransition
+	}
+
+	now := s.now()
+	if err := s.prRepo.ClosePullRequest(pullRequestId, &now); err != nil {
 		return nil, err
 	}
+	pr.Status = models.PullRequestStatusCLOSED
+	pr.ClosedAt = &now
+	return pr, nil
+}
 
-	var candidates []models.User
+// ReopenPullRequest moves a CLOSED PR back to OPEN. Reviewers that are no
+// longer active or are absent are dropped and the free slots are refilled
+// like /pullRequest/addReviewers does. Reopening an OPEN PR is a no-op.
+func (s *PullRequestService) ReopenPullRequest(pullRequestId string) ([]string, *models.PullRequest, error) {
+	var pr *models.PullRequest
+	removed := []string{}
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if pr.Status == models.PullRequestStatusOPEN {
+			return nil
+		}
+		if !pr.Status.CanTransition(models.PullRequestStatusOPEN) {
+			return models.ErrInvalidTransition
+		}
+
+		available, err := s.userRepo.GetAvailableByIDs(pr.AssignedReviewers, s.now())
+		if err != nil {
+			return err
+		}
+		keep := make(map[string]struct{}, len(available))
+		for _, u := range available {
+			keep[u.UserID] = struct{}{}
+		}
+		reviewers := make([]string, 0, len(pr.AssignedReviewers))
+		for _, id := range pr.AssignedReviewers {
+			if _, ok := keep[id]; ok {
+				reviewers = append(reviewers, id)
+			} else {
+				removed = append(removed, id)
+			}
+		}
+		pr.AssignedReviewers = reviewers
+		pr.FallbackReviewers = slices.DeleteFunc(pr.FallbackReviewers, func(id string) bool {
+			_, ok := keep[id]
+			return !ok
+		})
+		for _, id := range removed {
+			pr.ForgetReviewer(id)
+		}
+		// the review SLA of the kept reviewers starts over
+		pr.OverdueReviewers = nil
+		pr.StampAssigned(s.now(), reviewers...)
+		pr.NeedMoreReviewers = !pr.Draft && len(pr.AssignedReviewers) < pr.ReviewersCount
+		pr.Status = models.PullRequestStatusOPEN
+		pr.ClosedAt = nil
+
+		if err := s.prRepo.UpdateAssignment(tx, pr, "status", "closed_at"); err != nil {
+			return err
+		}
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonUnavailable}
+		if err := s.historyRepo.AppendTx(tx, cause.Removed(pr.PullRequestID, s.now(), removed...)); err != nil {
+			return err
+		}
+		if pr.Draft {
+			return nil
+		}
+
+		// the PR is open again even if nobody can take the free slots
+		cause = models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonTopUp}
+		if _, err := s.topUp(tx, pr, cause); err != nil && err != models.ErrAtCapacity {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return removed, pr, nil
+}
+
+// mergePolicyFor returns the merge policy of the author's team. Only an
+// author without a team has no policy; failed lookups are errors so that the
+// merge is not let through.
+func (s *PullRequestService) mergePolicyFor(pr *models.PullRequest) (*models.MergePolicy, error) {
+	author, err := s.userRepo.GetByID(pr.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	if author.TeamName == "" {
+		return nil, nil
+	}
+	team, err := s.teamRepo.GetTeamByName(author.TeamName)
+	if err != nil {
+		return nil, err
+	}
+	return team.MergePolicy, nil
+}
+
+// SubmitReview records a review by an assigned reviewer. A verdict clears the
+// reviewer's overdue mark.
+func (s *PullRequestService) SubmitReview(pullRequestId, reviewerID string, state models.ReviewState, comment string) (*models.PullRequest, error) {
+	if !state.Valid() {
+		return nil, models.ErrInvalidReview
+	}
+
+	var pr *models.PullRequest
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if pr.Status == models.PullRequestStatusMERGED {
+			return models.ErrReviewMerged
+		}
+		if pr.Status == models.PullRequestStatusCLOSED {
+			return models.ErrPRClosed
+		}
+		if !slices.Contains(pr.AssignedReviewers, reviewerID) {
+			return models.ErrNotAssigned
+		}
+
+		review := models.Review{
+			ReviewerID:  reviewerID,
+			State:       state,
+			Comment:     comment,
+			SubmittedAt: s.now(),
+		}
+		if err := s.prRepo.AddReview(tx, pullRequestId, review); err != nil {
+			return err
+		}
+		pr.Reviews = append(pr.Reviews, review)
+
+		// a verdict meets the review SLA
+		if state == models.ReviewStateCommented || !slices.Contains(pr.OverdueReviewers, reviewerID) {
+			return nil
+		}
+		pr.OverdueReviewers = slices.DeleteFunc(pr.OverdueReviewers, func(id string) bool { return id == reviewerID })
+		return s.prRepo.UpdateOverdue(tx, pr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// pickWithFallback picks up to n reviewers from first, then from owner if it is
+// another team and, while slots remain, from the fallback teams of owner in
+// order. Reviewers outside owner are also
+// returned as fallback. Missing fallback teams are skipped. ErrAtCapacity is
+// returned when nobody was picked and some team had only full candidates.
+func (s *PullRequestService) pickWithFallback(a *assignment, owner, first *models.Team, exclude, avoid map[string]struct{}, n int) ([]string, []string, error) {
+	picked := []string{}
+	fallback := []string{}
+	full := false
+
+	names := append([]string{first.TeamName, owner.TeamName}, owner.FallbackTeams...)
+	visited := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if len(picked) >= n {
+			break
+		}
+		if _, ok := visited[name]; ok || name == "" {
+			continue
+		}
+		visited[name] = struct{}{}
+
+		var team *models.Team
+		pool := "team"
+		switch name {
+		case first.TeamName:
+			team = first
+		case owner.TeamName:
+			team = owner
+		default:
+			var err error
+			if team, err = s.teamByName(a, name); err != nil {
+				continue
+			}
+			pool = "fallback"
+		}
+
+		candidates, err := s.candidates(team.TeamName, exclude)
+		if err != nil {
+			return nil, nil, err
+		}
+		revs, err := s.pickAvoiding(a, team, pool, candidates, avoid, n-len(picked))
+		if err == models.ErrAtCapacity {
+			full = true
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, id := range revs {
+			exclude[id] = struct{}{}
+		}
+		picked = append(picked, revs...)
+		if team.TeamName != owner.TeamName {
+			fallback = append(fallback, revs...)
+		}
+	}
+	if len(picked) == 0 && full {
+		return nil, nil, models.ErrAtCapacity
+	}
+	return picked, fallback, nil
+}
+
+// pickAvoiding picks among candidates outside avoid first and takes the
+// avoided ones only for the remaining slots. Candidates from other teams than
+// team, such as owners named by an ownership rule, are picked by pickByTeam
+// under their own team settings.
+func (s *PullRequestService) pickAvoiding(a *assignment, team *models.Team, pool string, candidates []models.User, avoid map[string]struct{}, n int) ([]string, error) {
+	var preferred, avoided []models.User
+	for _, u := range candidates {
+		if _, ok := avoid[u.UserID]; ok {
+			avoided = append(avoided, u)
+		} else {
+			preferred = append(preferred, u)
+		}
+	}
+
+	picked := []string{}
+	full := false
+	for i, group := range [][]models.User{preferred, avoided} {
+		if len(picked) >= n {
+			break
+		}
+		if i > 0 {
+			if len(group) == 0 {
+				break
+			}
+			pool += "/avoided"
+		}
+		revs, err := s.pickByTeam(a, team, pool, group, n-len(picked))
+		if err == models.ErrAtCapacity {
+			full = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		picked = append(picked, revs...)
+	}
+	if len(picked) == 0 && full {
+		return nil, models.ErrAtCapacity
+	}
+	return picked, nil
+}
+
+// pickByTeam picks up to n reviewers among candidates, members of team first,
+// then the other teams by name. Each candidate is checked against the
+// capacity, strategy and weights of their own team; a candidate without a
+// team has only their personal limit.
+func (s *PullRequestService) pickByTeam(a *assignment, team *models.Team, pool string, candidates []models.User, n int) ([]string, error) {
+	byTeam := map[string][]models.User{}
+	for _, u := range candidates {
+		byTeam[u.TeamName] = append(byTeam[u.TeamName], u)
+	}
+	names := make([]string, 0, len(byTeam)+1)
+	for name := range byTeam {
+		if name != team.TeamName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := byTeam[team.TeamName]; ok || len(names) == 0 {
+		names = append([]string{team.TeamName}, names...)
+	}
+
+	picked := []string{}
+	full := false
+	for _, name := range names {
+		if len(picked) >= n {
+			break
+		}
+		own := team
+		if name != team.TeamName {
+			own = &models.Team{TeamName: name}
+			if name != "" {
+				var err error
+				if own, err = s.teamByName(a, name); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		revs, err := s.pickReviewers(a, own, pool, byTeam[name], n-len(picked))
+		if err == models.ErrAtCapacity {
+			full = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		picked = append(picked, revs...)
+	}
+	if len(picked) == 0 && full {
+		return nil, models.ErrAtCapacity
+	}
+	return picked, nil
+}
+
+// applyReviewRules adds the reviewers excluded for authorID by the team rules
+// to exclude and returns the reviewers that were paired with the author on
+// each of their latest MaxConsecutivePairings PRs other than prID.
+func (s *PullRequestService) applyReviewRules(a *assignment, team *models.Team, authorID, prID string, exclude map[string]struct{}) (map[string]struct{}, error) {
+	for _, id := range team.ReviewRules.ExcludedReviewers(authorID) {
+		exclude[id] = struct{}{}
+	}
+
+	avoid := map[string]struct{}{}
+	if team.ReviewRules == nil || team.ReviewRules.MaxConsecutivePairings == 0 {
+		return avoid, nil
+	}
+	limit := team.ReviewRules.MaxConsecutivePairings
+	latest, err := s.latestByAuthor(a, authorID, prID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) < limit {
+		return avoid, nil
+	}
+
+	streak := map[string]int{}
+	for _, pr := range latest {
+		for _, r := range pr.AssignedReviewers {
+			streak[r]++
+		}
+	}
+	for id, n := range streak {
+		if n == limit {
+			avoid[id] = struct{}{}
+		}
+	}
+	return avoid, nil
+}
+
+// ownerCandidates returns active owners of changedFiles according to the team
+// ownership rules, except the excluded users.
+func (s *PullRequestService) ownerCandidates(team *models.Team, changedFiles []string, exclude map[string]struct{}) ([]models.User, error) {
+	var userIDs, teamNames []string
+	for _, file := range changedFiles {
+		for i := len(team.OwnershipRules) - 1; i >= 0; i-- {
+			if rule := team.OwnershipRules[i]; rule.Match(file) {
+				userIDs = append(userIDs, rule.Users...)
+				teamNames = append(teamNames, rule.Teams...)
+				break
+			}
+		}
+	}
+	if len(userIDs) == 0 && len(teamNames) == 0 {
+		return nil, nil
+	}
+
+	owners, err := s.userRepo.GetAvailableOwners(userIDs, teamNames, s.now())
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]models.User, 0, len(owners))
+	for _, u := range owners {
+		if _, ok := exclude[u.UserID]; !ok {
+			candidates = append(candidates, u)
+		}
+	}
+	return candidates, nil
+}
+
+// reviewersCount validates the per-PR override against the number of the
+// author's teammates.
+func (s *PullRequestService) reviewersCount(team *models.Team, override *int) (int, error) {
+	if override == nil {
+		if team.ReviewersCount > 0 {
+			return team.ReviewersCount, nil
+		}
+		return models.DefaultReviewersCount, nil
+	}
+
+	if team.TeamName == "" {
+		if *override < 1 {
+			return 0, models.ErrInvalidReviewersCount
+		}
+		return *override, nil
+	}
+	members, err := s.userRepo.GetUsersByTeam(team.TeamName)
+	if err != nil {
+		return 0, err
+	}
+	if *override < 1 || *override > len(members)-1 {
+		return 0, models.ErrInvalidReviewersCount
+	}
+	return *override, nil
+}
+
+// authorTeam returns the team of the author of a PR. A teamless author gets an
+// empty team: nobody is picked from it and the PR waits with
+// need_more_reviewers until reviewers are added by hand.
+func (s *PullRequestService) authorTeam(author *models.User) (*models.Team, error) {
+	if author.TeamName == "" {
+		return &models.Team{}, nil
+	}
+	return s.teamRepo.GetTeamByName(author.TeamName)
+}
+
+// isLargePR reports whether a PR of size changed lines needs the extra
+// reviewer of the team.
+func isLargePR(team *models.Team, size int) bool {
+	return team.LargePRLines > 0 && size >= team.LargePRLines
+}
+
+// withExtraReviewer adds one to count unless the team has nobody to fill it.
+func (s *PullRequestService) withExtraReviewer(team *models.Team, count int) (int, error) {
+	members, err := s.userRepo.GetUsersByTeam(team.TeamName)
+	if err != nil {
+		return 0, err
+	}
+	if count+1 > len(members)-1 {
+		return count, nil
+	}
+	return count + 1, nil
+}
+
+// UpdatePullRequest changes the PR name and metadata. A PR that grows past the
+// team large_pr_lines threshold gets an extra reviewer slot, filled right away
+// when the PR is OPEN and not a draft; the added reviewers are returned.
+func (s *PullRequestService) UpdatePullRequest(pullRequestId string, upd models.PullRequestUpdate) ([]string, *models.PullRequest, error) {
+	var pr *models.PullRequest
+	added := []string{}
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if pr.Status == models.PullRequestStatusMERGED {
+			return models.ErrUpdateMerged
+		}
+
+		author, err := s.userRepo.GetByID(pr.AuthorID)
+		if err != nil {
+			return err
+		}
+		team, err := s.authorTeam(author)
+		if err != nil {
+			return err
+		}
+
+		wasLarge := isLargePR(team, pr.Size())
+		upd.Apply(pr)
+		if !pr.Valid() {
+			return models.ErrInvalidMetadata
+		}
+		open := pr.Status == models.PullRequestStatusOPEN && !pr.Draft
+		grown := !wasLarge && isLargePR(team, pr.Size())
+		if grown {
+			if pr.ReviewersCount, err = s.withExtraReviewer(team, pr.ReviewersCount); err != nil {
+				return err
+			}
+			pr.NeedMoreReviewers = open && len(pr.AssignedReviewers) < pr.ReviewersCount
+		}
+
+		err = s.prRepo.Update(tx, pr, "pull_request_name", "repository", "target_branch", "labels", "priority",
+			"additions", "deletions", "reviewers_count", "need_more_reviewers")
+		// only the slot added for growing past large_pr_lines is filled here
+		if err != nil || !open || !grown {
+			return err
+		}
+		revs, err := s.topUp(tx, pr, models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonLargePR})
+		if err == models.ErrAtCapacity {
+			return nil
+		}
+		added = revs
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, pr, nil
+}
+
+// candidates returns available members of the team except the excluded users.
+func (s *PullRequestService) candidates(teamName string, exclude map[string]struct{}) ([]models.User, error) {
+	activeUsers, err := s.userRepo.GetAvailableUsersByTeam(teamName, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]models.User, 0, len(activeUsers))
 	for _, u := range activeUsers {
-		if u.UserID != author.UserID {
+		if _, ok := exclude[u.UserID]; !ok {
 			candidates = append(candidates, u)
 		}
 	}
+	return candidates, nil
+}
 
-	numToPick := 2
-	if len(candidates) < 2 {
-		numToPick = len(candidates)
+// reviewExclusions returns the author, the current reviewers and the
+// reviewers that declined the PR.
+func reviewExclusions(pr *models.PullRequest) map[string]struct{} {
+	exclude := map[string]struct{}{pr.AuthorID: {}}
+	for _, r := range pr.AssignedReviewers {
+		exclude[r] = struct{}{}
+	}
+	for _, r := range pr.DeclinedReviewers {
+		exclude[r] = struct{}{}
 	}
-	if numToPick == 0 {
+	return exclude
+}
+
+// pickReviewers selects up to n reviewers among candidates below their
+// capacity and records the step in the assignment. It returns ErrAtCapacity
+// if every candidate is full.
+func (s *PullRequestService) pickReviewers(a *assignment, team *models.Team, pool string, candidates []models.User, n int) ([]string, error) {
+	if n == 0 {
 		return []string{}, nil
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(candidates), func(i, j int) {
-		candidates[i], candidates[j] = candidates[j], candidates[i]
-	})
+	// selection depends on the candidate order, keep it independent of the DB
+	users := make([]models.User, len(candidates))
+	copy(users, candidates)
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.UserID)
+	}
+	step := models.SelectionStep{
+		Team:       team.TeamName,
+		Pool:       pool,
+		Strategy:   s.strategyFor(team),
+		Candidates: ids,
+		Requested:  n,
+		Picked:     []string{},
+	}
+	if len(users) == 0 {
+		a.decision.Steps = append(a.decision.Steps, step)
+		return []string{}, nil
+	}
 
-	revs := make([]string, 0, 2)
-	for i := 0; i < numToPick; i++ {
-		revs = append(revs, candidates[i].UserID)
+	load, err := s.openReviews(a, ids)
+	if err != nil {
+		return nil, err
+	}
+	step.Load = load
+
+	free := make([]models.User, 0, len(users))
+	for _, u := range users {
+		if atCapacity(u, team, load) {
+			step.AtCapacity = append(step.AtCapacity, u.UserID)
+		} else {
+			free = append(free, u)
+		}
+	}
+	if len(free) == 0 {
+		a.decision.Steps = append(a.decision.Steps, step)
+		return nil, models.ErrAtCapacity
 	}
-	return revs, nil
+	if step.Strategy == models.ReviewerStrategyWeighted {
+		step.Weights = candidateWeights(team, free)
+	}
+
+	if step.Strategy == models.ReviewerStrategyRoundRobin {
+		if a.tx != nil {
+			if team.RoundRobinCursor, err = s.teamRepo.LockRoundRobinCursor(a.tx, team.TeamName); err != nil {
+				return nil, err
+			}
+		}
+		step.Cursor = team.RoundRobinCursor
+	}
+
+	step.Picked = s.selectors[step.Strategy].Select(SelectionInput{
+		Team:       team,
+		Candidates: free,
+		Load:       load,
+		Rand:       a.rand,
+	}, n)
+	a.decision.Steps = append(a.decision.Steps, step)
+	return step.Picked, nil
 }
 
-func (s *PullRequestService) ReassignReviewer(pullRequestId string, oldReviewerID string) (string, *models.PullRequest, error) {
-	pr, err := s.prRepo.GetByID(pullRequestId)
+// openReviews returns the open review load of the users, taken from the
+// simulated state for a simulated assignment.
+func (s *PullRequestService) openReviews(a *assignment, userIDs []string) (map[string]int, error) {
+	if a.sim == nil {
+		return s.prRepo.CountOpenReviews(userIDs)
+	}
+	return a.sim.openReviews(s.prRepo, userIDs)
+}
+
+// latestByAuthor returns the latest PRs of the author other than prID, newest
+// first; a simulated assignment sees the simulated PRs only.
+func (s *PullRequestService) latestByAuthor(a *assignment, authorID, prID string, limit int) ([]models.PullRequest, error) {
+	if a.sim == nil {
+		return s.prRepo.GetLatestByAuthor(authorID, prID, limit)
+	}
+	return a.sim.latestByAuthor(authorID, limit), nil
+}
+
+// teamByName returns the team; a simulated assignment keeps one copy per
+// team so that round_robin cursors advance across simulated PRs.
+func (s *PullRequestService) teamByName(a *assignment, name string) (*models.Team, error) {
+	if a.sim == nil {
+		return s.teamRepo.GetTeamByName(name)
+	}
+	return a.sim.team(s.teamRepo, name)
+}
+
+// saveDecisions appends the decisions and stores the round_robin cursors
+// their steps moved, in tx.
+func (s *PullRequestService) saveDecisions(tx *gorm.DB, decisions []models.AssignmentDecision) error {
+	if err := s.historyRepo.AppendDecisionsTx(tx, decisions); err != nil {
+		return err
+	}
+
+	cursors := map[string]string{}
+	for _, d := range decisions {
+		for _, step := range d.Steps {
+			// a requested reviewer is not picked by the selector
+			if step.Strategy == models.ReviewerStrategyRoundRobin && step.Pool != "requested" && len(step.Picked) > 0 {
+				cursors[step.Team] = step.Picked[len(step.Picked)-1]
+			}
+		}
+	}
+	// the rows are locked by the selection already; a fixed order keeps
+	// the writes deterministic
+	teams := slices.Sorted(maps.Keys(cursors))
+	for _, name := range teams {
+		if err := s.teamRepo.UpdateRoundRobinCursor(tx, name, cursors[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func atCapacity(u models.User, team *models.Team, load map[string]int) bool {
+	limit := u.Capacity(team)
+	return limit > 0 && load[u.UserID] >= limit
+}
+
+// strategyFor returns the team strategy, or random if it is not registered.
+func (s *PullRequestService) strategyFor(team *models.Team) models.ReviewerStrategy {
+	if _, ok := s.selectors[team.ReviewerStrategy]; ok {
+		return team.ReviewerStrategy
+	}
+	return models.ReviewerStrategyRandom
+}
+
+// ReassignReviewer replaces the reviewer with one from their team or, failing
+// that, the author's team and then its fallback teams. A non-empty newReviewerID
+// names the replacement instead; it must be eligible the same way a picked
+// one is. The change is recorded in the PR history with the given cause.
+func (s *PullRequestService) ReassignReviewer(pullRequestId, oldReviewerID, newReviewerID string, cause models.AssignmentCause) (string, *models.PullRequest, error) {
+	return s.reassign(pullRequestId, oldReviewerID, newReviewerID, cause, false)
+}
+
+// DeclineReview replaces the reviewer the same way ReassignReviewer picks a
+// replacement and keeps them from being picked for the PR again. The reviewer
+// stays assigned if there is no replacement.
+func (s *PullRequestService) DeclineReview(pullRequestId, reviewerID, reason string) (string, *models.PullRequest, error) {
+	cause := models.AssignmentCause{Actor: reviewerID, Reason: reason}
+	return s.reassign(pullRequestId, reviewerID, "", cause, true)
+}
+
+func (s *PullRequestService) reassign(pullRequestId, oldReviewerID, newReviewerID string, cause models.AssignmentCause, declined bool) (string, *models.PullRequest, error) {
+	var newReviewer string
+	var pr *models.PullRequest
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		// the row lock keeps a concurrent reassignment, e.g. one from the SLA
+		// watcher, from replacing the assignment read here
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		newReviewer, err = s.reassignLocked(tx, pr, oldReviewerID, newReviewerID, cause, declined)
+		return err
+	})
 	if err != nil {
-		return "", nil, models.ErrNotFound
+		return "", nil, err
 	}
+	return newReviewer, pr, nil
+}
+
+// reassignLocked replaces oldReviewerID on pr, whose row tx holds locked.
+func (s *PullRequestService) reassignLocked(tx *gorm.DB, pr *models.PullRequest, oldReviewerID, newReviewerID string, cause models.AssignmentCause, declined bool) (string, error) {
 	if pr.Status == models.PullRequestStatusMERGED {
-		return "", nil, models.ErrPRMerged
+		return "", models.ErrPRMerged
+	}
+	if pr.Status == models.PullRequestStatusCLOSED {
+		return "", models.ErrPRClosed
 	}
 
 	oldReviewer, err := s.userRepo.GetByID(oldReviewerID)
 	if err != nil {
-		return "", nil, models.ErrNotFound
+		return "", models.ErrNotFound
 	}
 
 	isAssigned := false
@@ -119,33 +1015,44 @@ func (s *PullRequestService) ReassignReviewer(pullRequestId string, oldReviewerI
 		}
 	}
 	if !isAssigned {
-		return "", nil, models.ErrNotAssigned
+		return "", models.ErrNotAssigned
 	}
 
-	activeUsers, err := s.userRepo.GetActiveUsersByTeam(oldReviewer.TeamName)
+	author, err := s.userRepo.GetByID(pr.AuthorID)
 	if err != nil {
-		return "", nil, err
+		return "", err
 	}
-
-	exclude := map[string]struct{}{}
-	exclude[pr.AuthorID] = struct{}{}
-	for _, r := range pr.AssignedReviewers {
-		exclude[r] = struct{}{}
+	owner, err := s.authorTeam(author)
+	if err != nil {
+		return "", err
 	}
-
-	candidates := make([]string, 0)
-	for _, u := range activeUsers {
-		if _, ok := exclude[u.UserID]; !ok {
-			candidates = append(candidates, u.UserID)
-		}
+	// the old reviewer's team goes first; a reviewer that left every team
+	// is replaced from the author's team
+	first := &models.Team{TeamName: oldReviewer.TeamName}
+	if team, err := s.teamRepo.GetTeamByName(oldReviewer.TeamName); err == nil {
+		first = team
 	}
 
-	if len(candidates) == 0 {
-		return "", nil, models.ErrNoCandidate
+	a := s.newAssignment(tx, pr.PullRequestID, models.AssignmentActionReassign)
+	exclude := reviewExclusions(pr)
+	avoid, err := s.applyReviewRules(a, owner, pr.AuthorID, pr.PullRequestID, exclude)
+	if err != nil {
+		return "", err
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	newReviewer := candidates[r.Intn(len(candidates))]
+	var picked, fallback []string
+	if newReviewerID != "" {
+		picked, fallback, err = s.requestedReviewer(a, owner, first, newReviewerID, exclude)
+	} else {
+		picked, fallback, err = s.pickWithFallback(a, owner, first, exclude, avoid, 1)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(picked) == 0 {
+		return "", models.ErrNoCandidate
+	}
+	newReviewer := picked[0]
 
 	for i, reviewer := range pr.AssignedReviewers {
 		if reviewer == oldReviewerID {
@@ -153,10 +1060,453 @@ func (s *PullRequestService) ReassignReviewer(pullRequestId string, oldReviewerI
 			break
 		}
 	}
+	pr.FallbackReviewers = slices.DeleteFunc(pr.FallbackReviewers, func(id string) bool { return id == oldReviewerID })
+	pr.FallbackReviewers = append(pr.FallbackReviewers, fallback...)
+	pr.ForgetReviewer(oldReviewerID)
+	pr.StampAssigned(a.decision.At, newReviewer)
+	if declined {
+		pr.DeclinedReviewers = append(pr.DeclinedReviewers, oldReviewerID)
+	}
 
-	if err := s.prRepo.Save(pr); err != nil {
-		return "", nil, err
+	if err := s.prRepo.UpdateAssignment(tx, pr); err != nil {
+		return "", err
+	}
+	if err := s.saveDecisions(tx, []models.AssignmentDecision{*a.decision}); err != nil {
+		return "", err
 	}
+	if err := s.historyRepo.AppendTx(tx, cause.Replaced(pr.PullRequestID, a.decision.At, oldReviewerID, newReviewer)); err != nil {
+		return "", err
+	}
+	return newReviewer, nil
+}
 
-	return newReviewer, pr, nil
+// requestedReviewer checks that the user named as a replacement is available,
+// not excluded and a member of the first team, the owner team or one of its
+// fallback teams, and records the step in the assignment. Consecutive pairing
+// limits do not apply to a named reviewer.
+func (s *PullRequestService) requestedReviewer(a *assignment, owner, first *models.Team, userID string, exclude map[string]struct{}) ([]string, []string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, nil, models.ErrNotFound
+	}
+	step := models.SelectionStep{
+		Team:       user.TeamName,
+		Pool:       "requested",
+		Candidates: []string{userID},
+		Requested:  1,
+		Picked:     []string{},
+	}
+	a.decision.Steps = append(a.decision.Steps, step)
+	last := &a.decision.Steps[len(a.decision.Steps)-1]
+
+	eligible := user.TeamName != "" &&
+		(user.TeamName == first.TeamName || user.TeamName == owner.TeamName || slices.Contains(owner.FallbackTeams, user.TeamName))
+	if _, ok := exclude[userID]; ok || !eligible {
+		return nil, nil, models.ErrNotEligible
+	}
+	available, err := s.userRepo.GetAvailableByIDs([]string{userID}, s.now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(available) == 0 {
+		return nil, nil, models.ErrNotEligible
+	}
+
+	team, err := s.teamRepo.GetTeamByName(user.TeamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	load, err := s.prRepo.CountOpenReviews([]string{userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	last.Strategy = s.strategyFor(team)
+	last.Load = load
+	if atCapacity(*user, team, load) {
+		last.AtCapacity = []string{userID}
+		return nil, nil, models.ErrAtCapacity
+	}
+	last.Picked = []string{userID}
+
+	var fallback []string
+	if user.TeamName != owner.TeamName && slices.Contains(owner.FallbackTeams, user.TeamName) {
+		fallback = []string{userID}
+	}
+	return []string{userID}, fallback, nil
+}
+
+// DeactivateTeamUsers deactivates the given team members and, in the same
+// transaction, replaces them on every OPEN PR with active teammates.
+func (s *PullRequestService) DeactivateTeamUsers(teamName string, userIDs []string) (*models.DeactivationReport, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	members, err := s.userRepo.GetUsersByTeam(teamName)
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[string]struct{}, len(members))
+	for _, u := range members {
+		isMember[u.UserID] = struct{}{}
+	}
+	for _, id := range userIDs {
+		if _, ok := isMember[id]; !ok {
+			return nil, models.ErrNotFound
+		}
+	}
+
+	report := &models.DeactivationReport{
+		TeamName:    teamName,
+		Deactivated: userIDs,
+	}
+	err = s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		if err := s.userRepo.DeactivateUsers(tx, userIDs); err != nil {
+			return err
+		}
+
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonDeactivated}
+		replacements, err := s.ReplaceReviewers(tx, team, userIDs, cause)
+		if err != nil {
+			return err
+		}
+		report.PullRequests = replacements
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ReplaceReviewers replaces userIDs on every OPEN PR with available members of
+// team, picked by the team selector. Reviewers without a replacement are
+// dropped from the PR and listed in NoCandidate. The changes are recorded in
+// the PR history with the given cause.
+func (s *PullRequestService) ReplaceReviewers(tx *gorm.DB, team *models.Team, userIDs []string, cause models.AssignmentCause) ([]models.ReviewerReplacement, error) {
+	gone := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		gone[id] = struct{}{}
+	}
+
+	activeUsers, err := s.userRepo.GetAvailableUsersByTeam(team.TeamName, s.now())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(activeUsers, func(i, j int) bool { return activeUsers[i].UserID < activeUsers[j].UserID })
+	var candidates []models.User
+	var candidateIDs []string
+	for _, u := range activeUsers {
+		if _, ok := gone[u.UserID]; !ok {
+			candidates = append(candidates, u)
+			candidateIDs = append(candidateIDs, u.UserID)
+		}
+	}
+
+	load, err := s.prRepo.CountOpenReviews(candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	// the cursor is shared by every replacement below
+	if s.strategyFor(team) == models.ReviewerStrategyRoundRobin {
+		if team.RoundRobinCursor, err = s.teamRepo.LockRoundRobinCursor(tx, team.TeamName); err != nil {
+			return nil, err
+		}
+	}
+	in := SelectionInput{
+		Team:       team,
+		Candidates: candidates,
+		Load:       load,
+	}
+
+	prs, err := s.prRepo.GetOpenByReviewers(tx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := s.excludedReviewers(tx, prs)
+	if err != nil {
+		return nil, err
+	}
+
+	replacements := make([]models.ReviewerReplacement, 0, len(prs))
+	decisions := make([]models.AssignmentDecision, 0, len(prs))
+	var events []models.AssignmentEvent
+	now := s.now()
+	for i := range prs {
+		res, decision := s.replaceReviewers(&prs[i], gone, excluded[prs[i].AuthorID], in)
+		replacements = append(replacements, res)
+		decisions = append(decisions, decision)
+
+		olds := make([]string, 0, len(res.Replaced))
+		for old := range res.Replaced {
+			olds = append(olds, old)
+		}
+		sort.Strings(olds)
+		for _, old := range olds {
+			events = append(events, cause.Replaced(res.PullRequestID, now, old, res.Replaced[old])...)
+		}
+		events = append(events, cause.Removed(res.PullRequestID, now, res.NoCandidate...)...)
+	}
+
+	if err := s.prRepo.UpdateReviewers(tx, prs); err != nil {
+		return nil, err
+	}
+	if err := s.saveDecisions(tx, decisions); err != nil {
+		return nil, err
+	}
+	if err := s.historyRepo.AppendTx(tx, events); err != nil {
+		return nil, err
+	}
+	return replacements, nil
+}
+
+// excludedReviewers returns, per author of prs, the reviewers excluded by the
+// review rules of the author's team.
+func (s *PullRequestService) excludedReviewers(tx *gorm.DB, prs []models.PullRequest) (map[string][]string, error) {
+	authorIDs := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		authorIDs = append(authorIDs, pr.AuthorID)
+	}
+	authors, err := s.userRepo.GetByIDs(tx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := map[string]*models.Team{}
+	excluded := make(map[string][]string, len(authors))
+	for _, author := range authors {
+		team, ok := teams[author.TeamName]
+		if !ok {
+			if team, err = s.teamRepo.GetTeamByName(author.TeamName); err != nil {
+				team = &models.Team{}
+			}
+			teams[author.TeamName] = team
+		}
+		excluded[author.UserID] = team.ReviewRules.ExcludedReviewers(author.UserID)
+	}
+	return excluded, nil
+}
+
+// replaceReviewers swaps every reviewer from gone for a candidate picked by the
+// team selector, skipping the excluded users, and returns the decision made.
+// in.Load is updated so that later PRs see the new assignments.
+func (s *PullRequestService) replaceReviewers(pr *models.PullRequest, gone map[string]struct{}, excluded []string, in SelectionInput) (models.ReviewerReplacement, models.AssignmentDecision) {
+	res := models.ReviewerReplacement{
+		PullRequestID: pr.PullRequestID,
+		Replaced:      map[string]string{},
+	}
+
+	a := s.newAssignment(nil, pr.PullRequestID, models.AssignmentActionReplace)
+	in.Rand = a.rand
+
+	exclude := reviewExclusions(pr)
+	for _, id := range excluded {
+		exclude[id] = struct{}{}
+	}
+	pool := make([]models.User, 0, len(in.Candidates))
+	var full []string
+	for _, u := range in.Candidates {
+		if _, ok := exclude[u.UserID]; ok {
+			continue
+		}
+		if atCapacity(u, in.Team, in.Load) {
+			full = append(full, u.UserID)
+			continue
+		}
+		pool = append(pool, u)
+	}
+
+	strategy := s.strategyFor(in.Team)
+	selector := s.selectors[strategy]
+	kept := make([]string, 0, len(pr.AssignedReviewers))
+	for _, old := range pr.AssignedReviewers {
+		if _, ok := gone[old]; !ok {
+			kept = append(kept, old)
+			continue
+		}
+
+		pr.ForgetReviewer(old)
+		// the replacement comes from the same team, so it keeps the
+		// fallback mark of the old reviewer
+		fb := slices.Index(pr.FallbackReviewers, old)
+
+		in.Candidates = pool
+		cursor := in.Team.RoundRobinCursor
+		picked := selector.Select(in, 1)
+		step := models.SelectionStep{
+			Team:       in.Team.TeamName,
+			Pool:       "team",
+			Strategy:   strategy,
+			Candidates: make([]string, 0, len(pool)),
+			AtCapacity: full,
+			Load:       map[string]int{},
+			Requested:  1,
+			Picked:     picked,
+		}
+		if strategy == models.ReviewerStrategyWeighted {
+			step.Weights = candidateWeights(in.Team, pool)
+		}
+		if strategy == models.ReviewerStrategyRoundRobin {
+			step.Cursor = cursor
+		}
+		for _, u := range pool {
+			step.Candidates = append(step.Candidates, u.UserID)
+			if n := in.Load[u.UserID]; n > 0 {
+				step.Load[u.UserID] = n
+			}
+		}
+		a.decision.Steps = append(a.decision.Steps, step)
+		if len(picked) == 0 {
+			res.NoCandidate = append(res.NoCandidate, old)
+			if fb >= 0 {
+				pr.FallbackReviewers = slices.Delete(pr.FallbackReviewers, fb, fb+1)
+			}
+			continue
+		}
+
+		newID := picked[0]
+		kept = append(kept, newID)
+		res.Replaced[old] = newID
+		pr.StampAssigned(a.decision.At, newID)
+		if fb >= 0 {
+			pr.FallbackReviewers[fb] = newID
+		}
+		in.Load[newID]++
+		for i, u := range pool {
+			if u.UserID == newID {
+				pool = append(pool[:i], pool[i+1:]...)
+				break
+			}
+		}
+	}
+
+	pr.AssignedReviewers = kept
+	if len(res.NoCandidate) > 0 {
+		pr.NeedMoreReviewers = true
+	}
+	return res, *a.decision
+}
+
+// AssignmentTrace returns the recorded reviewer assignments of the PR, oldest
+// first.
+func (s *PullRequestService) AssignmentTrace(pullRequestId string) ([]models.AssignmentDecision, error) {
+	if _, err := s.prRepo.GetByID(pullRequestId); err != nil {
+		return nil, models.ErrNotFound
+	}
+	return s.historyRepo.GetDecisionsByPR(pullRequestId)
+}
+
+// History returns the reviewer history of the PR, oldest first.
+func (s *PullRequestService) History(pullRequestId string) ([]models.AssignmentEvent, error) {
+	if _, err := s.prRepo.GetByID(pullRequestId); err != nil {
+		return nil, models.ErrNotFound
+	}
+	return s.historyRepo.GetByPR(pullRequestId)
+}
+
+// AddReviewers fills the free reviewer slots of an OPEN PR from the author's
+// team and returns the added reviewers.
+func (s *PullRequestService) AddReviewers(pullRequestId string) ([]string, *models.PullRequest, error) {
+	var pr *models.PullRequest
+	var added []string
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pr, err = s.prRepo.GetByIDForUpdate(tx, pullRequestId)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if pr.Status == models.PullRequestStatusMERGED {
+			return models.ErrAddReviewersMerged
+		}
+		if pr.Status == models.PullRequestStatusCLOSED {
+			return models.ErrPRClosed
+		}
+		if pr.Draft {
+			return models.ErrPRDraft
+		}
+
+		added, err = s.topUp(tx, pr, models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonTopUp})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, pr, nil
+}
+
+// TopUpTeam fills the free reviewer slots of every OPEN PR authored by the
+// team members that is flagged with need_more_reviewers.
+func (s *PullRequestService) TopUpTeam(teamName string) error {
+	prs, err := s.prRepo.GetNeedingReviewers(teamName)
+	if err != nil {
+		return err
+	}
+	cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonTopUp}
+	for i := range prs {
+		err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+			// the PR may have changed since it was listed
+			pr, err := s.prRepo.GetByIDForUpdate(tx, prs[i].PullRequestID)
+			if err != nil {
+				return err
+			}
+			if pr.Status != models.PullRequestStatusOPEN || pr.Draft || !pr.NeedMoreReviewers {
+				return nil
+			}
+			_, err = s.topUp(tx, pr, cause)
+			return err
+		})
+		if err != nil && err != models.ErrAtCapacity {
+			return err
+		}
+	}
+	return nil
+}
+
+// topUp fills the free reviewer slots of the PR, whose row tx holds locked,
+// and writes the assignment and its history in tx.
+func (s *PullRequestService) topUp(tx *gorm.DB, pr *models.PullRequest, cause models.AssignmentCause) ([]string, error) {
+	missing := pr.ReviewersCount - len(pr.AssignedReviewers)
+	if missing <= 0 {
+		if pr.NeedMoreReviewers {
+			pr.NeedMoreReviewers = false
+			return []string{}, s.prRepo.UpdateAssignment(tx, pr)
+		}
+		return []string{}, nil
+	}
+
+	author, err := s.userRepo.GetByID(pr.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	team, err := s.authorTeam(author)
+	if err != nil {
+		return nil, err
+	}
+	a := s.newAssignment(tx, pr.PullRequestID, models.AssignmentActionTopUp)
+	exclude := reviewExclusions(pr)
+	avoid, err := s.applyReviewRules(a, team, pr.AuthorID, pr.PullRequestID, exclude)
+	if err != nil {
+		return nil, err
+	}
+	added, fallback, err := s.pickWithFallback(a, team, team, exclude, avoid, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	pr.AssignedReviewers = append(pr.AssignedReviewers, added...)
+	pr.FallbackReviewers = append(pr.FallbackReviewers, fallback...)
+	pr.StampAssigned(a.decision.At, added...)
+	pr.NeedMoreReviewers = len(pr.AssignedReviewers) < pr.ReviewersCount
+	if len(added) == 0 {
+		return added, nil
+	}
+	if err := s.prRepo.UpdateAssignment(tx, pr); err != nil {
+		return nil, err
+	}
+	if err := s.saveDecisions(tx, []models.AssignmentDecision{*a.decision}); err != nil {
+		return nil, err
+	}
+	return added, s.historyRepo.AppendTx(tx, cause.Assigned(pr.PullRequestID, a.decision.At, added...))
 }
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"math/rand"
+	"pr_reviewer_service_go/internal/models"
+	"sort"
+)
+
+// ReviewerSelector picks up to n reviewers out of the given candidates.
+type ReviewerSelector interface {
+	Select(in SelectionInput, n int) []string
+}
+
+type SelectionInput struct {
+	Team       *models.Team
+	Candidates []models.User
+	Load       map[string]int // open reviews per candidate
+	Rand       *rand.Rand
+}
+
+func newSelectors() map[models.ReviewerStrategy]ReviewerSelector {
+	return map[models.ReviewerStrategy]ReviewerSelector{
+		models.ReviewerStrategyRandom:      randomSelector{},
+		models.ReviewerStrategyRoundRobin:  roundRobinSelector{},
+		models.ReviewerStrategyLeastLoaded: leastLoadedSelector{},
+		models.ReviewerStrategyWeighted:    weightedSelector{},
+	}
+}
+
+type randomSelector struct{}
+
+func (randomSelector) Select(in SelectionInput, n int) []string {
+	return firstN(shuffled(in), n)
+}
+
+type leastLoadedSelector struct{}
+
+func (leastLoadedSelector) Select(in SelectionInput, n int) []string {
+	users := shuffled(in)
+	// users are already shuffled, so a stable sort breaks ties randomly
+	sort.SliceStable(users, func(i, j int) bool {
+		return in.Load[users[i].UserID] < in.Load[users[j].UserID]
+	})
+	return firstN(users, n)
+}
+
+// roundRobinSelector walks team members in user_id order, continuing after
+// Team.RoundRobinCursor, and moves the cursor to its last pick. The caller
+// stores the cursor along with the assignment.
+type roundRobinSelector struct{}
+
+func (roundRobinSelector) Select(in SelectionInput, n int) []string {
+	users := make([]models.User, len(in.Candidates))
+	copy(users, in.Candidates)
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	if n > len(users) {
+		n = len(users)
+	}
+	if n == 0 {
+		return []string{}
+	}
+
+	last := in.Team.RoundRobinCursor
+	start := sort.Search(len(users), func(i int) bool { return users[i].UserID > last })
+
+	revs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		revs = append(revs, users[(start+i)%len(users)].UserID)
+	}
+	in.Team.RoundRobinCursor = revs[len(revs)-1]
+	return revs
+}
+
+// weightedSelector samples without replacement proportionally to
+// Team.ReviewerWeights. Members missing from the map weigh 1, members with a
+// non-positive weight are never picked.
+type weightedSelector struct{}
+
+func (weightedSelector) Select(in SelectionInput, n int) []string {
+	users := make([]models.User, 0, len(in.Candidates))
+	weights := make([]int, 0, len(in.Candidates))
+	total := 0
+	for _, u := range in.Candidates {
+		w := weightOf(in.Team, u.UserID)
+		if w <= 0 {
+			continue
+		}
+		users = append(users, u)
+		weights = append(weights, w)
+		total += w
+	}
+
+	revs := make([]string, 0, n)
+	for len(revs) < n && total > 0 {
+		x := in.Rand.Intn(total)
+		i := 0
+		for x >= weights[i] {
+			x -= weights[i]
+			i++
+		}
+		revs = append(revs, users[i].UserID)
+		total -= weights[i]
+		weights[i] = 0
+	}
+	return revs
+}
+
+// weightOf returns the weight of the user in Team.ReviewerWeights, 1 if the
+// user is missing from it.
+func weightOf(team *models.Team, userID string) int {
+	if w, ok := team.ReviewerWeights[userID]; ok {
+		return w
+	}
+	return 1
+}
+
+// candidateWeights returns the weights the weighted selector uses for users,
+// so that a recorded step can be replayed after the team weights change.
+func candidateWeights(team *models.Team, users []models.User) map[string]int {
+	weights := make(map[string]int, len(users))
+	for _, u := range users {
+		weights[u.UserID] = weightOf(team, u.UserID)
+	}
+	return weights
+}
+
+func shuffled(in SelectionInput) []models.User {
+	users := make([]models.User, len(in.Candidates))
+	copy(users, in.Candidates)
+	in.Rand.Shuffle(len(users), func(i, j int) {
+		users[i], users[j] = users[j], users[i]
+	})
+	return users
+}
+
+func firstN(users []models.User, n int) []string {
+	if n > len(users) {
+		n = len(users)
+	}
+	revs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		revs = append(revs, users[i].UserID)
+	}
+	return revs
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/repository"
+	"sort"
+	"time"
+)
+
+type SimulationService struct {
+	prRepo   *repository.PullRequestRepository
+	userRepo *repository.UserRepository
+	teamRepo *repository.TeamRepository
+	prSvc    *PullRequestService
+	seeds    func() int64
+}
+
+func NewSimulationService(pr *repository.PullRequestRepository, ur *repository.UserRepository, tr *repository.TeamRepository, prSvc *PullRequestService) *SimulationService {
+	return &SimulationService{prRepo: pr, userRepo: ur, teamRepo: tr, prSvc: prSvc,
+		seeds: func() int64 { return time.Now().UnixNano() }}
+}
+
+// SetSeedSource replaces the source of seeds of simulations without a seed.
+// It is kept apart from the one of real assignments, so simulating does not
+// shift their sequence.
+func (s *SimulationService) SetSeedSource(seeds func() int64) {
+	s.seeds = seeds
+}
+
+// Simulate assigns reviewers to prs, then to the team PRs created within
+// [from, to) if historical is set, using the team settings overridden by
+// policy. Reviewers are picked by the same code as real assignments, ownership
+// rules, fallback teams and review rules included, but nothing is written:
+// simulated assignments only add to an in-memory copy of the current open
+// review load, consecutive pairings are counted over the simulated PRs and
+// round_robin cursors only move on in-memory copies of the teams.
+func (s *SimulationService) Simulate(teamName string, policy models.SimulationPolicy, prs []models.SimulatedPR, historical bool, from, to *time.Time, seed *int64) (*models.SimulationResult, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	if policy.ReviewerStrategy != "" {
+		if !policy.ReviewerStrategy.Valid() {
+			return nil, models.ErrUnknownStrategy
+		}
+		team.ReviewerStrategy = policy.ReviewerStrategy
+	}
+	if policy.ReviewerWeights != nil {
+		team.ReviewerWeights = policy.ReviewerWeights
+	}
+	if policy.ReviewersCount < 0 {
+		return nil, models.ErrInvalidReviewersCount
+	}
+	if policy.ReviewersCount > 0 {
+		team.ReviewersCount = policy.ReviewersCount
+	}
+	if policy.MaxOpenReviews != nil {
+		if *policy.MaxOpenReviews < 0 {
+			return nil, models.ErrInvalidMaxOpenReviews
+		}
+		team.MaxOpenReviews = *policy.MaxOpenReviews
+	}
+
+	if historical {
+		past, err := s.historicalPRs(teamName, from, to)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(past, prs...)
+	}
+	if len(prs) == 0 {
+		return nil, models.ErrEmptySimulation
+	}
+
+	members, err := s.userRepo.GetAvailableUsersByTeam(teamName, s.prSvc.now())
+	if err != nil {
+		return nil, err
+	}
+
+	sd := s.seeds()
+	if seed != nil {
+		sd = *seed
+	}
+	rng := rand.New(rand.NewSource(sd))
+	state := newSimulatedState(team)
+
+	count := team.ReviewersCount
+	if count <= 0 {
+		count = models.DefaultReviewersCount
+	}
+
+	res := &models.SimulationResult{
+		TeamName:         teamName,
+		ReviewerStrategy: s.prSvc.strategyFor(team),
+		Seed:             sd,
+		PullRequests:     make([]models.SimulatedPR, 0, len(prs)),
+		Distribution:     make(map[string]int, len(members)),
+	}
+	for _, u := range members {
+		res.Distribution[u.UserID] = 0
+	}
+
+	for _, sim := range prs {
+		pr := models.PullRequest{
+			PullRequestID:  sim.PullRequestID,
+			AuthorID:       sim.AuthorID,
+			ReviewersCount: count,
+			ChangedFiles:   sim.ChangedFiles,
+		}
+		a := &assignment{
+			rand:     rng,
+			decision: &models.AssignmentDecision{Steps: []models.SelectionStep{}},
+			sim:      state,
+		}
+		err := s.prSvc.assignReviewers(a, team, &pr)
+		if err != nil && err != models.ErrAtCapacity {
+			return nil, err
+		}
+		state.record(&pr)
+
+		sim.Reviewers = pr.AssignedReviewers
+		if sim.Reviewers == nil {
+			sim.Reviewers = []string{}
+		}
+		for _, id := range sim.Reviewers {
+			res.Distribution[id]++
+		}
+		if len(sim.Reviewers) < count {
+			res.Unfilled++
+		}
+		res.PullRequests = append(res.PullRequests, sim)
+	}
+
+	res.Min, res.Max, res.Mean, res.StdDev = spread(res.Distribution)
+	return res, nil
+}
+
+// historicalPRs returns the authors of the team PRs created within [from, to),
+// oldest first.
+func (s *SimulationService) historicalPRs(teamName string, from, to *time.Time) ([]models.SimulatedPR, error) {
+	prs, err := s.prRepo.GetForStats(teamName, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].CreatedAt.Before(prs[j].CreatedAt) })
+
+	res := make([]models.SimulatedPR, 0, len(prs))
+	for _, pr := range prs {
+		if within(pr.CreatedAt, from, to) {
+			res = append(res, models.SimulatedPR{PullRequestID: pr.PullRequestID, AuthorID: pr.AuthorID, ChangedFiles: pr.ChangedFiles})
+		}
+	}
+	return res, nil
+}
+
+// simulatedState stands in for the stored review state of the assignments of
+// one simulation.
+type simulatedState struct {
+	load   map[string]int
+	latest map[string][]models.PullRequest // simulated PRs per author, newest first
+	teams  map[string]*models.Team
+}
+
+// newSimulatedState starts a simulation of assignments for team, whose
+// settings may be overridden.
+func newSimulatedState(team *models.Team) *simulatedState {
+	return &simulatedState{
+		load:   map[string]int{},
+		latest: map[string][]models.PullRequest{},
+		teams:  map[string]*models.Team{team.TeamName: team},
+	}
+}
+
+// team returns the simulation copy of the team, reading it on first use.
+func (st *simulatedState) team(teamRepo *repository.TeamRepository, name string) (*models.Team, error) {
+	if team, ok := st.teams[name]; ok {
+		return team, nil
+	}
+	team, err := teamRepo.GetTeamByName(name)
+	if err != nil {
+		return nil, err
+	}
+	st.teams[name] = team
+	return team, nil
+}
+
+// openReviews returns the load of the users, reading the stored open reviews
+// of users seen for the first time.
+func (st *simulatedState) openReviews(prRepo *repository.PullRequestRepository, userIDs []string) (map[string]int, error) {
+	var unseen []string
+	for _, id := range userIDs {
+		if _, ok := st.load[id]; !ok {
+			unseen = append(unseen, id)
+		}
+	}
+	if len(unseen) > 0 {
+		counts, err := prRepo.CountOpenReviews(unseen)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range unseen {
+			st.load[id] = counts[id]
+		}
+	}
+
+	load := make(map[string]int, len(userIDs))
+	for _, id := range userIDs {
+		if n := st.load[id]; n > 0 {
+			load[id] = n
+		}
+	}
+	return load, nil
+}
+
+func (st *simulatedState) latestByAuthor(authorID string, limit int) []models.PullRequest {
+	latest := st.latest[authorID]
+	return latest[:min(limit, len(latest))]
+}
+
+// record adds the simulated assignment of pr to the state.
+func (st *simulatedState) record(pr *models.PullRequest) {
+	for _, id := range pr.AssignedReviewers {
+		st.load[id]++
+	}
+	st.latest[pr.AuthorID] = append([]models.PullRequest{*pr}, st.latest[pr.AuthorID]...)
+}
+
+func spread(counts map[string]int) (int, int, float64, float64) {
+	if len(counts) == 0 {
+		return 0, 0, 0, 0
+	}
+
+	minCount, maxCount, sum := math.MaxInt, 0, 0
+	for _, n := range counts {
+		minCount = min(minCount, n)
+		maxCount = max(maxCount, n)
+		sum += n
+	}
+	mean := float64(sum) / float64(len(counts))
+
+	variance := 0.0
+	for _, n := range counts {
+		variance += (float64(n) - mean) * (float64(n) - mean)
+	}
+	return minCount, maxCount, mean, math.Sqrt(variance / float64(len(counts)))
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"log"
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/repository"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SLAService watches the team review SLAs: a reviewer that has not approved
+// or requested changes within review_sla_hours of being assigned is overdue.
+type SLAService struct {
+	prRepo          *repository.PullRequestRepository
+	teamRepo        *repository.TeamRepository
+	transactionRepo *repository.TransactionRepository
+	prSvc           *PullRequestService
+}
+
+func NewSLAService(pr *repository.PullRequestRepository, tr *repository.TeamRepository, trx *repository.TransactionRepository, prSvc *PullRequestService) *SLAService {
+	return &SLAService{prRepo: pr, teamRepo: tr, transactionRepo: trx, prSvc: prSvc}
+}
+
+// Overdue returns the reviews overdue at the given time (now, by the service
+// clock, if nil) of one team or, if teamName is empty, of every team with an
+// SLA, along with the time used.
+func (s *SLAService) Overdue(teamName string, at *time.Time) (time.Time, []models.OverdueReview, error) {
+	now := s.prSvc.now()
+	if at != nil {
+		now = *at
+	}
+	teams, err := s.teams(teamName)
+	if err != nil {
+		return now, nil, err
+	}
+
+	res := []models.OverdueReview{}
+	for i := range teams {
+		prs, err := s.prRepo.GetOpenByAuthorTeam(teams[i].TeamName)
+		if err != nil {
+			return now, nil, err
+		}
+		for j := range prs {
+			res = append(res, overdueReviews(&teams[i], &prs[j], now)...)
+		}
+	}
+	return now, res, nil
+}
+
+func (s *SLAService) teams(teamName string) ([]models.Team, error) {
+	if teamName == "" {
+		return s.teamRepo.GetWithReviewSLA()
+	}
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	if team.ReviewSLAHours == 0 {
+		return []models.Team{}, nil
+	}
+	return []models.Team{*team}, nil
+}
+
+func overdueReviews(team *models.Team, pr *models.PullRequest, at time.Time) []models.OverdueReview {
+	sla := time.Duration(team.ReviewSLAHours) * time.Hour
+	var res []models.OverdueReview
+	for _, reviewer := range pr.AssignedReviewers {
+		if pr.HasVerdict(reviewer) {
+			continue
+		}
+		assigned := pr.AssignedAt(reviewer)
+		due := assigned.Add(sla)
+		if !at.After(due) {
+			continue
+		}
+		res = append(res, models.OverdueReview{
+			PullRequestID:   pr.PullRequestID,
+			PullRequestName: pr.PullRequestName,
+			AuthorID:        pr.AuthorID,
+			TeamName:        team.TeamName,
+			ReviewerID:      reviewer,
+			AssignedAt:      assigned,
+			DueAt:           due,
+		})
+	}
+	return res
+}
+
+// WatchOverdue marks overdue reviewers on their PRs every interval and, for
+// teams with auto_reassign_overdue, hands the reviews over like
+// /pullRequest/reassign, until ctx is done.
+func (s *SLAService) WatchOverdue(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.markOverdue(s.prSvc.now()); err != nil {
+				log.Println("review sla:", err)
+			}
+		}
+	}
+}
+
+func (s *SLAService) markOverdue(now time.Time) error {
+	teams, err := s.teamRepo.GetWithReviewSLA()
+	if err != nil {
+		return err
+	}
+	for i := range teams {
+		prs, err := s.prRepo.GetOpenByAuthorTeam(teams[i].TeamName)
+		if err != nil {
+			return err
+		}
+		for j := range prs {
+			if err := s.handleOverdue(&teams[i], &prs[j], now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleOverdue works from pr as listed, which may be stale by now: each
+// reassignment locks and re-reads the PR, and the marks are written to the
+// locked current row.
+func (s *SLAService) handleOverdue(team *models.Team, pr *models.PullRequest, now time.Time) error {
+	overdue := overdueReviews(team, pr, now)
+	if len(overdue) == 0 {
+		return nil
+	}
+
+	keep := map[string]struct{}{}
+	for _, o := range overdue {
+		keep[o.ReviewerID] = struct{}{}
+	}
+	if team.AutoReassignOverdue {
+		cause := models.AssignmentCause{Actor: models.ActorSLAWatcher, Reason: models.ReasonOverdue}
+		for _, o := range overdue {
+			_, _, err := s.prSvc.ReassignReviewer(pr.PullRequestID, o.ReviewerID, "", cause)
+			switch err {
+			case nil, models.ErrNotAssigned, models.ErrPRMerged, models.ErrPRClosed:
+				// handed over, or the PR changed since it was listed
+				delete(keep, o.ReviewerID)
+			case models.ErrNoCandidate, models.ErrAtCapacity:
+				// nobody to hand over to, the reviewer stays marked
+			default:
+				return err
+			}
+		}
+		if len(keep) == 0 {
+			return nil
+		}
+	}
+
+	return s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		current, err := s.prRepo.GetByIDForUpdate(tx, pr.PullRequestID)
+		if err != nil {
+			return err
+		}
+		if current.Status != models.PullRequestStatusOPEN {
+			return nil
+		}
+		changed := false
+		for _, o := range overdueReviews(team, current, now) {
+			if _, ok := keep[o.ReviewerID]; !ok || slices.Contains(current.OverdueReviewers, o.ReviewerID) {
+				continue
+			}
+			current.OverdueReviewers = append(current.OverdueReviewers, o.ReviewerID)
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		return s.prRepo.UpdateOverdue(tx, current)
+	})
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"pr_reviewer_service_go/internal/db"
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/repository"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
+// slaFixture wires the services against the database of DATABASE_URL with a
+// clock the test moves by hand.
+type slaFixture struct {
+	prRepo *repository.PullRequestRepository
+	prSvc  *PullRequestService
+	teams  *TeamService
+	sla    *SLAService
+	now    time.Time
+}
+
+func newSLAFixture(t *testing.T) *slaFixture {
+	t.Helper()
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	migrateOnce.Do(func() {
+		db.Connect()
+		migrateErr = db.Migrate()
+	})
+	if migrateErr != nil {
+		t.Fatalf("migrate: %v", migrateErr)
+	}
+
+	userRepo := repository.NewUserRepository()
+	teamRepo := repository.NewTeamRepository()
+	trRepo := repository.NewTransactionRepository()
+
+	f := &slaFixture{prRepo: repository.NewPRRepository(), now: time.Now().UTC()}
+	f.prSvc = NewPRService(f.prRepo, userRepo, teamRepo, trRepo, repository.NewHistoryRepository())
+	f.prSvc.SetClock(func() time.Time { return f.now })
+	f.teams = NewTeamService(teamRepo, userRepo, trRepo, f.prSvc)
+	f.sla = NewSLAService(f.prRepo, teamRepo, trRepo, f.prSvc)
+	return f
+}
+
+// team creates a team of the given members with a one hour review SLA and
+// one reviewer per PR, and returns it with the ID of its first member, the
+// author.
+func (f *slaFixture) team(t *testing.T, autoReassign bool, members ...string) (*models.Team, string) {
+	t.Helper()
+	suffix := fmt.Sprintf("_%d", time.Now().UnixNano())
+	req := &models.Team{TeamName: "sla_team" + suffix, ReviewersCount: 1}
+	for i := range members {
+		members[i] += suffix
+		req.Members = append(req.Members, models.TeamMember{UserId: members[i], Username: members[i], IsActive: true})
+	}
+	if _, _, err := f.teams.Create(req); err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	team, err := f.teams.SetReviewSLA(req.TeamName, 1, autoReassign)
+	if err != nil {
+		t.Fatalf("set review sla: %v", err)
+	}
+	return team, members[0]
+}
+
+func (f *slaFixture) createPR(t *testing.T, authorID string) *models.PullRequest {
+	t.Helper()
+	pr, err := f.prSvc.Create("sla_pr_"+authorID, "SLA", authorID, nil, nil, models.PullRequestMetadata{}, false)
+	if err != nil {
+		t.Fatalf("create pr: %v", err)
+	}
+	if len(pr.AssignedReviewers) != 1 {
+		t.Fatalf("expected 1 reviewer, got %v", pr.AssignedReviewers)
+	}
+	return &pr
+}
+
+func (f *slaFixture) get(t *testing.T, prID string) *models.PullRequest {
+	t.Helper()
+	pr, err := f.prRepo.GetByID(prID)
+	if err != nil {
+		t.Fatalf("get pr: %v", err)
+	}
+	return pr
+}
+
+func TestMarkOverdueMarksReviewer(t *testing.T) {
+	f := newSLAFixture(t)
+	_, author := f.team(t, false, "author", "reviewer")
+	pr := f.createPR(t, author)
+	reviewer := pr.AssignedReviewers[0]
+
+	f.now = f.now.Add(2 * time.Hour)
+	if err := f.sla.markOverdue(f.now); err != nil {
+		t.Fatalf("markOverdue: %v", err)
+	}
+	if got := f.get(t, pr.PullRequestID).OverdueReviewers; !slices.Equal(got, []string{reviewer}) {
+		t.Fatalf("expected %s overdue, got %v", reviewer, got)
+	}
+
+	// a verdict clears the mark
+	if _, err := f.prSvc.SubmitReview(pr.PullRequestID, reviewer, models.ReviewStateApproved, ""); err != nil {
+		t.Fatalf("submit review: %v", err)
+	}
+	if got := f.get(t, pr.PullRequestID).OverdueReviewers; len(got) != 0 {
+		t.Errorf("expected no overdue reviewers after approval, got %v", got)
+	}
+}
+
+func TestHandleOverdueReassigns(t *testing.T) {
+	f := newSLAFixture(t)
+	team, author := f.team(t, true, "author", "reviewer1", "reviewer2")
+	pr := f.createPR(t, author)
+	reviewer := pr.AssignedReviewers[0]
+
+	f.now = f.now.Add(2 * time.Hour)
+	if err := f.sla.handleOverdue(team, pr, f.now); err != nil {
+		t.Fatalf("handleOverdue: %v", err)
+	}
+
+	current := f.get(t, pr.PullRequestID)
+	if len(current.AssignedReviewers) != 1 || current.AssignedReviewers[0] == reviewer {
+		t.Errorf("expected %s to be replaced, got %v", reviewer, current.AssignedReviewers)
+	}
+	if len(current.OverdueReviewers) != 0 {
+		t.Errorf("expected no overdue reviewers after reassign, got %v", current.OverdueReviewers)
+	}
+}
+
+func TestHandleOverdueKeepsMarkWithoutCandidate(t *testing.T) {
+	f := newSLAFixture(t)
+	team, author := f.team(t, true, "author", "reviewer")
+	pr := f.createPR(t, author)
+	reviewer := pr.AssignedReviewers[0]
+
+	f.now = f.now.Add(2 * time.Hour)
+	if err := f.sla.handleOverdue(team, pr, f.now); err != nil {
+		t.Fatalf("handleOverdue: %v", err)
+	}
+	if got := f.get(t, pr.PullRequestID).OverdueReviewers; !slices.Equal(got, []string{reviewer}) {
+		t.Errorf("expected %s to stay marked, got %v", reviewer, got)
+	}
+}
+
+func TestHandleOverdueStaleMergedPR(t *testing.T) {
+	for _, autoReassign := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auto_reassign=%v", autoReassign), func(t *testing.T) {
+			f := newSLAFixture(t)
+			team, author := f.team(t, autoReassign, "author", "reviewer1", "reviewer2")
+			stale := f.createPR(t, author)
+			if _, err := f.prSvc.MergePullRequest(stale.PullRequestID); err != nil {
+				t.Fatalf("merge: %v", err)
+			}
+
+			f.now = f.now.Add(2 * time.Hour)
+			if err := f.sla.handleOverdue(team, stale, f.now); err != nil {
+				t.Fatalf("handleOverdue on a merged PR: %v", err)
+			}
+			if got := f.get(t, stale.PullRequestID).OverdueReviewers; len(got) != 0 {
+				t.Errorf("expected a merged PR to stay unmarked, got %v", got)
+			}
+		})
+	}
+}
+
+func TestHandleOverdueStaleReplacedReviewer(t *testing.T) {
+	for _, autoReassign := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auto_reassign=%v", autoReassign), func(t *testing.T) {
+			f := newSLAFixture(t)
+			team, author := f.team(t, autoReassign, "author", "reviewer1", "reviewer2")
+			stale := f.createPR(t, author)
+			reviewer := stale.AssignedReviewers[0]
+
+			cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonReassigned}
+			newReviewer, _, err := f.prSvc.ReassignReviewer(stale.PullRequestID, reviewer, "", cause)
+			if err != nil {
+				t.Fatalf("reassign: %v", err)
+			}
+
+			// the new reviewer was assigned at the same time, so both are past the SLA
+			f.now = f.now.Add(2 * time.Hour)
+			if err := f.sla.handleOverdue(team, stale, f.now); err != nil {
+				t.Fatalf("handleOverdue on a stale PR: %v", err)
+			}
+			current := f.get(t, stale.PullRequestID)
+			if slices.Contains(current.OverdueReviewers, reviewer) {
+				t.Errorf("expected replaced reviewer %s to stay unmarked, got %v", reviewer, current.OverdueReviewers)
+			}
+			if !autoReassign && slices.Contains(current.OverdueReviewers, newReviewer) {
+				t.Errorf("expected %s, missing from the stale copy, to stay unmarked, got %v", newReviewer, current.OverdueReviewers)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"pr_reviewer_service_go/internal/models"
+	"pr_reviewer_service_go/internal/repository"
+	"sort"
+	"time"
+)
+
+type StatsService struct {
+	prRepo *repository.PullRequestRepository
+}
+
+func NewStatsService(pr *repository.PullRequestRepository) *StatsService {
+	return &StatsService{prRepo: pr}
+}
+
+// Assignments counts review assignments per user and reviewers per PR.
+// Total and open assignments are taken from PRs created within [from, to),
+// merged ones from PRs merged within the same range.
+func (s *StatsService) Assignments(teamName string, from, to *time.Time) (*models.AssignmentStats, error) {
+	prs, err := s.prRepo.GetForStats(teamName, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := map[string]*models.UserAssignmentStats{}
+	userStats := func(id string) *models.UserAssignmentStats {
+		st, ok := byUser[id]
+		if !ok {
+			st = &models.UserAssignmentStats{UserID: id}
+			byUser[id] = st
+		}
+		return st
+	}
+
+	stats := &models.AssignmentStats{
+		Users:        []models.UserAssignmentStats{},
+		PullRequests: make([]models.PRReviewerStats, 0, len(prs)),
+	}
+	for _, pr := range prs {
+		stats.PullRequests = append(stats.PullRequests, models.PRReviewerStats{
+			PullRequestID:  pr.PullRequestID,
+			Status:         pr.Status,
+			ReviewersCount: len(pr.AssignedReviewers),
+			Required:       pr.ReviewersCount,
+		})
+
+		created := within(pr.CreatedAt, from, to)
+		merged := pr.Status == models.PullRequestStatusMERGED && pr.MergedAt != nil && within(*pr.MergedAt, from, to)
+		for _, reviewer := range pr.AssignedReviewers {
+			st := userStats(reviewer)
+			if created {
+				st.Total++
+				if pr.Status == models.PullRequestStatusOPEN {
+					st.Open++
+				}
+			}
+			if merged {
+				st.Merged++
+			}
+		}
+	}
+
+	for _, st := range byUser {
+		stats.Users = append(stats.Users, *st)
+	}
+	sort.Slice(stats.Users, func(i, j int) bool { return stats.Users[i].UserID < stats.Users[j].UserID })
+
+	return stats, nil
+}
+
+func within(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && !t.Before(*to) {
+		return false
+	}
+	return true
+}
@@ -11,41 +11,443 @@ type TeamService struct {
 	teamRepo        *repository.TeamRepository
 	userRepo        *repository.UserRepository
 	transactionRepo *repository.TransactionRepository
+	prSvc           *PullRequestService
 }
 
-func NewTeamService(tr *repository.TeamRepository, ur *repository.UserRepository, transRepo *repository.TransactionRepository) *TeamService {
-	return &TeamService{teamRepo: tr, userRepo: ur, transactionRepo: transRepo}
+func NewTeamService(tr *repository.TeamRepository, ur *repository.UserRepository, transRepo *repository.TransactionRepository, prSvc *PullRequestService) *TeamService {
+	return &TeamService{teamRepo: tr, userRepo: ur, transactionRepo: transRepo, prSvc: prSvc}
 }
 
-func (s *TeamService) Create(req *models.Team) (*models.Team, error) {
+// Create adds a new team. Members that already exist are moved into it with
+// their username and active flag overwritten.
+func (s *TeamService) Create(req *models.Team) (*models.Team, *models.MemberChanges, error) {
+	if req.ReviewerStrategy == "" {
+		req.ReviewerStrategy = models.ReviewerStrategyRandom
+	}
+	if !req.ReviewerStrategy.Valid() {
+		return nil, nil, models.ErrUnknownStrategy
+	}
+	if req.ReviewersCount == 0 {
+		req.ReviewersCount = models.DefaultReviewersCount
+	}
+	if req.ReviewersCount < 0 {
+		return nil, nil, models.ErrInvalidReviewersCount
+	}
+	if req.MaxOpenReviews < 0 {
+		return nil, nil, models.ErrInvalidMaxOpenReviews
+	}
+	if req.LargePRLines < 0 {
+		return nil, nil, models.ErrInvalidLargePRLines
+	}
+	if req.ReviewSLAHours < 0 {
+		return nil, nil, models.ErrInvalidReviewSLA
+	}
+	if req.ReviewRules != nil && !req.ReviewRules.Valid() {
+		return nil, nil, models.ErrInvalidReviewRules
+	}
+	if err := s.validateFallbackTeams(req.TeamName, req.FallbackTeams); err != nil {
+		return nil, nil, err
+	}
+	if err := s.validateOwnershipRules(req.OwnershipRules); err != nil {
+		return nil, nil, err
+	}
+
+	users := make([]models.User, 0, len(req.Members))
+	ids := make([]string, 0, len(req.Members))
+	seen := make(map[string]struct{}, len(req.Members))
+	for _, member := range req.Members {
+		if _, ok := seen[member.UserId]; ok {
+			return nil, nil, models.ErrDuplicateMember
+		}
+		seen[member.UserId] = struct{}{}
+		ids = append(ids, member.UserId)
+		users = append(users, models.User{
+			UserID:   member.UserId,
+			Username: member.Username,
+			IsActive: member.IsActive,
+			TeamName: req.TeamName,
+		})
+	}
+
+	changes := &models.MemberChanges{Created: []string{}, Updated: []string{}}
 	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
 		if err := s.teamRepo.CreateTeam(tx, req); err != nil {
 			return err
 		}
+		if len(users) == 0 {
+			return s.validateMergePolicy(tx, req.MergePolicy)
+		}
 
-		for _, member := range req.Members {
-			user := &models.User{
-				UserID:   member.UserId,
-				Username: member.Username,
-				IsActive: member.IsActive,
-				TeamName: req.TeamName,
-			}
+		existing, err := s.userRepo.GetByIDs(tx, ids)
+		if err != nil {
+			return err
+		}
+		existed := make(map[string]struct{}, len(existing))
+		for _, u := range existing {
+			existed[u.UserID] = struct{}{}
+		}
 
-			if err := s.userRepo.CreateUser(tx, user); err != nil {
-				return err
-			}
+		if err := s.userRepo.UpsertUsers(tx, users); err != nil {
+			return err
+		}
+		// required_group may name members created above
+		if err := s.validateMergePolicy(tx, req.MergePolicy); err != nil {
+			return err
 		}
 
+		for _, u := range users {
+			if _, ok := existed[u.UserID]; ok {
+				changes.Updated = append(changes.Updated, u.UserID)
+			} else {
+				changes.Created = append(changes.Created, u.UserID)
+			}
+		}
 		return nil
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return req, nil
+	return req, changes, nil
 }
 
+// GetByName returns the team with members read from the users table.
 func (s *TeamService) GetByName(name string) (*models.Team, error) {
-	return s.teamRepo.GetTeamByName(name)
+	team, err := s.teamRepo.GetTeamByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.GetUsersByTeam(name)
+	if err != nil {
+		return nil, err
+	}
+	team.Members = make([]models.TeamMember, 0, len(users))
+	for _, u := range users {
+		team.Members = append(team.Members, models.TeamMember{
+			IsActive: u.IsActive,
+			UserId:   u.UserID,
+			Username: u.Username,
+		})
+	}
+	return team, nil
+}
+
+func (s *TeamService) SetReviewerStrategy(teamName string, strategy models.ReviewerStrategy, weights map[string]int) (*models.Team, error) {
+	if !strategy.Valid() {
+		return nil, models.ErrUnknownStrategy
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.ReviewerStrategy = strategy
+	team.ReviewerWeights = weights
+	if err := s.teamRepo.Update(team, "reviewer_strategy", "reviewer_weights"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetMergePolicy replaces the team merge policy; nil removes it.
+func (s *TeamService) SetMergePolicy(teamName string, policy *models.MergePolicy) (*models.Team, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	err = s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		return s.validateMergePolicy(tx, policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	team.MergePolicy = policy
+	if err := s.teamRepo.Update(team, "merge_policy"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// validateMergePolicy checks the policy and that every required_group user
+// exists; a nil policy is valid.
+func (s *TeamService) validateMergePolicy(tx *gorm.DB, policy *models.MergePolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if !policy.Valid() {
+		return models.ErrInvalidMergePolicy
+	}
+	if len(policy.RequiredGroup) == 0 {
+		return nil
+	}
+	users, err := s.userRepo.GetByIDs(tx, policy.RequiredGroup)
+	if err != nil {
+		return err
+	}
+	if len(users) != len(policy.RequiredGroup) {
+		return models.ErrInvalidMergePolicy
+	}
+	return nil
+}
+
+func (s *TeamService) SetReviewersCount(teamName string, count int) (*models.Team, error) {
+	if count < 1 {
+		return nil, models.ErrInvalidReviewersCount
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.ReviewersCount = count
+	if err := s.teamRepo.Update(team, "reviewers_count"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetMaxOpenReviews sets the default capacity of team members; 0 is
+// unlimited.
+func (s *TeamService) SetMaxOpenReviews(teamName string, limit int) (*models.Team, error) {
+	if limit < 0 {
+		return nil, models.ErrInvalidMaxOpenReviews
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.MaxOpenReviews = limit
+	if err := s.teamRepo.Update(team, "max_open_reviews"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetLargePRLines sets how many changed lines make a PR large enough for an
+// extra reviewer; 0 disables it.
+func (s *TeamService) SetLargePRLines(teamName string, lines int) (*models.Team, error) {
+	if lines < 0 {
+		return nil, models.ErrInvalidLargePRLines
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.LargePRLines = lines
+	if err := s.teamRepo.Update(team, "large_pr_lines"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetReviewSLA sets how many hours a reviewer has for a verdict (0 disables
+// the SLA) and whether overdue reviews are reassigned automatically.
+func (s *TeamService) SetReviewSLA(teamName string, hours int, autoReassign bool) (*models.Team, error) {
+	if hours < 0 {
+		return nil, models.ErrInvalidReviewSLA
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.ReviewSLAHours = hours
+	team.AutoReassignOverdue = autoReassign
+	if err := s.teamRepo.Update(team, "review_sla_hours", "auto_reassign_overdue"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetReviewRules replaces the team review rules; nil removes them.
+func (s *TeamService) SetReviewRules(teamName string, rules *models.ReviewRules) (*models.Team, error) {
+	if rules != nil && !rules.Valid() {
+		return nil, models.ErrInvalidReviewRules
+	}
+
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	team.ReviewRules = rules
+	if err := s.teamRepo.Update(team, "review_rules"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+// SetFallbackTeams replaces the ordered list of teams reviewers are drawn from
+// once the team itself has no candidates; an empty list removes it.
+func (s *TeamService) SetFallbackTeams(teamName string, fallbackTeams []string) (*models.Team, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	if err := s.validateFallbackTeams(teamName, fallbackTeams); err != nil {
+		return nil, err
+	}
+
+	team.FallbackTeams = fallbackTeams
+	if err := s.teamRepo.Update(team, "fallback_teams"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+func (s *TeamService) validateFallbackTeams(teamName string, fallbackTeams []string) error {
+	seen := make(map[string]struct{}, len(fallbackTeams))
+	for _, name := range fallbackTeams {
+		if _, ok := seen[name]; ok || name == teamName {
+			return models.ErrInvalidFallbackTeams
+		}
+		seen[name] = struct{}{}
+
+		if _, err := s.teamRepo.GetTeamByName(name); err != nil {
+			return models.ErrNotFound
+		}
+	}
+	return nil
+}
+
+// SetOwnershipRules replaces the team ownership rules; an empty list removes
+// them.
+func (s *TeamService) SetOwnershipRules(teamName string, rules []models.OwnershipRule) (*models.Team, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	if err := s.validateOwnershipRules(rules); err != nil {
+		return nil, err
+	}
+
+	team.OwnershipRules = rules
+	if err := s.teamRepo.Update(team, "ownership_rules"); err != nil {
+		return nil, err
+	}
+	return s.GetByName(teamName)
+}
+
+func (s *TeamService) validateOwnershipRules(rules []models.OwnershipRule) error {
+	for _, rule := range rules {
+		if !rule.Valid() {
+			return models.ErrInvalidOwnershipRule
+		}
+		for _, name := range rule.Teams {
+			if _, err := s.teamRepo.GetTeamByName(name); err != nil {
+				return models.ErrNotFound
+			}
+		}
+	}
+	return nil
+}
+
+// AddMember creates the user or moves an existing one into the team. A moved
+// user is replaced on the OPEN PRs they review with members of their old team.
+func (s *TeamService) AddMember(teamName string, member models.TeamMember) (*models.Team, []models.ReviewerReplacement, error) {
+	if _, err := s.teamRepo.GetTeamByName(teamName); err != nil {
+		return nil, nil, models.ErrNotFound
+	}
+	// a user moved out of another team hands over the reviews taken there,
+	// the same way RemoveMember does
+	var oldTeam *models.Team
+	if existing, err := s.userRepo.GetByID(member.UserId); err == nil && existing.TeamName != "" && existing.TeamName != teamName {
+		if oldTeam, err = s.teamRepo.GetTeamByName(existing.TeamName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	user := models.User{
+		UserID:   member.UserId,
+		Username: member.Username,
+		IsActive: member.IsActive,
+		TeamName: teamName,
+	}
+	replacements := []models.ReviewerReplacement{}
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		if err := s.userRepo.UpsertUsers(tx, []models.User{user}); err != nil {
+			return err
+		}
+		if oldTeam == nil {
+			return nil
+		}
+
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonLeftTeam}
+		var err error
+		replacements, err = s.prSvc.ReplaceReviewers(tx, oldTeam, []string{user.UserID}, cause)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	team, err := s.GetByName(teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return team, replacements, nil
+}
+
+// RemoveMember detaches the user from the team and replaces them on their
+// OPEN reviews with active teammates.
+func (s *TeamService) RemoveMember(teamName, userID string) (*models.Team, []models.ReviewerReplacement, error) {
+	team, err := s.teamRepo.GetTeamByName(teamName)
+	if err != nil {
+		return nil, nil, models.ErrNotFound
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || user.TeamName != teamName {
+		return nil, nil, models.ErrNotFound
+	}
+
+	var replacements []models.ReviewerReplacement
+	err = s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		if err := s.userRepo.SetTeam(tx, userID, ""); err != nil {
+			return err
+		}
+
+		cause := models.AssignmentCause{Actor: models.ActorAPI, Reason: models.ReasonLeftTeam}
+		replacements, err = s.prSvc.ReplaceReviewers(tx, team, []string{userID}, cause)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	team, err = s.GetByName(teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return team, replacements, nil
+}
+
+func (s *TeamService) Rename(teamName, newName string) (*models.Team, error) {
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		if err := s.teamRepo.Rename(tx, teamName, newName); err != nil {
+			return err
+		}
+		if err := s.teamRepo.RenameFallbackTeam(tx, teamName, newName); err != nil {
+			return err
+		}
+		if err := s.teamRepo.RenameOwnerTeam(tx, teamName, newName); err != nil {
+			return err
+		}
+		return s.userRepo.RenameTeam(tx, teamName, newName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByName(newName)
 }
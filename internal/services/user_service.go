@@ -1,15 +1,26 @@
 package services
 
 import (
+	"context"
+	"log"
 	"pr_reviewer_service_go/internal/models"
 	"pr_reviewer_service_go/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type UserService struct {
-	repo *repository.UserRepository
+	repo            *repository.UserRepository
+	absenceRepo     *repository.AbsenceRepository
+	teamRepo        *repository.TeamRepository
+	transactionRepo *repository.TransactionRepository
+	prSvc           *PullRequestService
 }
 
-func NewUserService(r *repository.UserRepository) *UserService { return &UserService{repo: r} }
+func NewUserService(r *repository.UserRepository, ar *repository.AbsenceRepository, tr *repository.TeamRepository, transRepo *repository.TransactionRepository, prSvc *PullRequestService) *UserService {
+	return &UserService{repo: r, absenceRepo: ar, teamRepo: tr, transactionRepo: transRepo, prSvc: prSvc}
+}
 
 func (s *UserService) SetUserActive(userID string, isActive bool) (*models.User, error) {
 	user, err := s.repo.GetByID(userID)
@@ -20,27 +31,156 @@ func (s *UserService) SetUserActive(userID string, isActive bool) (*models.User,
 	if err := s.repo.SetUserActiveStatus(userID, isActive); err != nil {
 		return nil, err
 	}
-
 	user.IsActive = isActive
+
+	if isActive && user.TeamName != "" {
+		// the user may fill PRs of teammates that are short of reviewers; the
+		// activation stands even if that fails
+		if err := s.prSvc.TopUpTeam(user.TeamName); err != nil {
+			log.Println("top up after activation:", err)
+		}
+	}
+	return user, nil
+}
+
+// SetMaxOpenReviews overrides the team capacity default for the user; nil
+// restores it.
+func (s *UserService) SetMaxOpenReviews(userID string, limit *int) (*models.User, error) {
+	if limit != nil && *limit < 0 {
+		return nil, models.ErrInvalidMaxOpenReviews
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	if err := s.repo.SetMaxOpenReviews(userID, limit); err != nil {
+		return nil, err
+	}
+	user.MaxOpenReviews = limit
 	return user, nil
 }
 
+// SetAbsence registers an unavailability window. If it has already begun, the
+// user's OPEN reviews are handed over right away; otherwise WatchAbsences does
+// it once the window starts.
+func (s *UserService) SetAbsence(userID string, start, end time.Time) (*models.Absence, []models.ReviewerReplacement, error) {
+	if _, err := s.repo.GetByID(userID); err != nil {
+		return nil, nil, models.ErrNotFound
+	}
+
+	now := s.prSvc.now()
+	if !end.After(start) || !end.After(now) {
+		return nil, nil, models.ErrInvalidAbsence
+	}
+
+	absence := &models.Absence{UserID: userID, StartsAt: start.UTC(), EndsAt: end.UTC()}
+	if err := s.absenceRepo.Create(absence); err != nil {
+		return nil, nil, err
+	}
+	if start.After(now) {
+		return absence, []models.ReviewerReplacement{}, nil
+	}
+
+	replacements, err := s.startAbsences(now, models.ActorAPI, absence.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	absence.ReassignedAt = &now
+	return absence, replacements, nil
+}
+
+// WatchAbsences hands over the reviews of users whose absence has begun, every
+// interval, until ctx is done.
+func (s *UserService) WatchAbsences(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.startAbsences(s.prSvc.now(), models.ActorAbsenceWatcher); err != nil {
+				log.Println("absences:", err)
+			}
+		}
+	}
+}
+
+// startAbsences claims the started absences (only ids when given), replaces
+// the absent users on OPEN PRs with available teammates and marks the
+// absences as handled, in one transaction. The changes are recorded in the PR
+// history as made by actor.
+func (s *UserService) startAbsences(now time.Time, actor string, ids ...uint) ([]models.ReviewerReplacement, error) {
+	replacements := []models.ReviewerReplacement{}
+	cause := models.AssignmentCause{Actor: actor, Reason: models.ReasonAbsent}
+	err := s.transactionRepo.Transaction(func(tx *gorm.DB) error {
+		absences, err := s.absenceRepo.ClaimStarted(tx, now, ids...)
+		if err != nil || len(absences) == 0 {
+			return err
+		}
+		claimed := make([]uint, 0, len(absences))
+		userIDs := make([]string, 0, len(absences))
+		for _, a := range absences {
+			claimed = append(claimed, a.ID)
+			userIDs = append(userIDs, a.UserID)
+		}
+
+		users, err := s.repo.GetByIDs(tx, userIDs)
+		if err != nil {
+			return err
+		}
+		byTeam := map[string][]string{}
+		for _, u := range users {
+			if u.TeamName != "" {
+				byTeam[u.TeamName] = append(byTeam[u.TeamName], u.UserID)
+			}
+		}
+
+		for teamName, members := range byTeam {
+			team, err := s.teamRepo.GetTeamByName(teamName)
+			if err != nil {
+				return err
+			}
+			replaced, err := s.prSvc.ReplaceReviewers(tx, team, members, cause)
+			if err != nil {
+				return err
+			}
+			replacements = append(replacements, replaced...)
+		}
+
+		return s.absenceRepo.MarkReassigned(tx, claimed, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replacements, nil
+}
+
 func (s *UserService) GetByID(userID string) (*models.User, error) {
 	return s.repo.GetByID(userID)
 }
 
-func (s *UserService) GetUserReviewPRs(userID string) ([]models.PullRequestShort, error) {
-	longprs, err := s.repo.GetUsersReviews(userID)
+// GetUserReviewPRs returns OPEN PRs matching the filter that still await the
+// user's approval or change request.
+func (s *UserService) GetUserReviewPRs(userID string, filter models.ReviewFilter) ([]models.PullRequestShort, error) {
+	longprs, err := s.repo.GetUsersReviews(userID, filter)
 	if err != nil {
 		return nil, err
 	}
 	shortprs := make([]models.PullRequestShort, 0, len(longprs))
 	for _, longpr := range longprs {
+		if longpr.HasVerdict(userID) {
+			continue
+		}
 		shortprs = append(shortprs, models.PullRequestShort{
 			AuthorId:        longpr.AuthorID,
 			PullRequestId:   longpr.PullRequestID,
 			PullRequestName: longpr.PullRequestName,
 			Status:          longpr.Status,
+
+			PullRequestMetadata: longpr.PullRequestMetadata,
 		})
 	}
 	return shortprs, nil
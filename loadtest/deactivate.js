@@ -0,0 +1,62 @@
+import http from 'k6/http';
+import exec from 'k6/execution';
+import { check } from 'k6';
+
+// Команда из USERS участников и PRS открытых PR; каждая итерация
+// деактивирует BATCH участников одним запросом, и сервис переназначает их
+// ревью. Итераций столько, чтобы активной осталась половина команды.
+const USERS = Number(__ENV.USERS || 300);
+const PRS = Number(__ENV.PRS || 3000);
+const BATCH = Number(__ENV.BATCH || 20);
+const ITERATIONS = Math.max(1, Math.floor(USERS / 2 / BATCH));
+
+export let options = {
+  setupTimeout: '10m',
+  scenarios: {
+    deactivate: {
+      executor: 'shared-iterations',
+      vus: 1,
+      iterations: ITERATIONS,
+    },
+  },
+  thresholds: {
+    'http_req_duration{name:deactivate_users}': ['p(95)<100'],
+    'http_req_failed{name:deactivate_users}': ['rate<0.001'],
+  },
+};
+
+const BASE_URL = __ENV.K6_BASE_URL || 'http://app_e2e:8080';
+const params = { headers: { 'Content-Type': 'application/json' } };
+
+export function setup() {
+  const teamName = `deact_${Date.now()}`;
+  const members = [];
+  for (let i = 0; i < USERS; i++) {
+    members.push({ user_id: `${teamName}_u${i}`, username: `User ${i}`, is_active: true });
+  }
+  let res = http.post(`${BASE_URL}/team/add`, JSON.stringify({ team_name: teamName, members }), params);
+  check(res, { 'team created': (r) => r.status === 201 });
+
+  for (let i = 0; i < PRS; i++) {
+    res = http.post(`${BASE_URL}/pullRequest/create`, JSON.stringify({
+      pull_request_id: `${teamName}_pr${i}`,
+      pull_request_name: `PR ${i}`,
+      author_id: `${teamName}_u${i % USERS}`,
+    }), params);
+    check(res, { 'pr created': (r) => r.status === 201 });
+  }
+  return { teamName };
+}
+
+export default function (data) {
+  const first = exec.scenario.iterationInTest * BATCH;
+  const userIDs = [];
+  for (let i = first; i < first + BATCH; i++) {
+    userIDs.push(`${data.teamName}_u${i}`);
+  }
+  const res = http.post(`${BASE_URL}/team/deactivateUsers`, JSON.stringify({
+    team_name: data.teamName,
+    user_ids: userIDs,
+  }), Object.assign({}, params, { tags: { name: 'deactivate_users' } }));
+  check(res, { 'users deactivated': (r) => r.status === 200 });
+}